@@ -0,0 +1,211 @@
+package redact
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// mode of newly created config files
+const defaultCfgMode os.FileMode = 0644
+
+// pendingCfg represents a fully written and synced temp file waiting to be
+// renamed over its config file
+type pendingCfg struct {
+	tmpPath string
+	cfgPath string
+	mode    os.FileMode
+	owner   string
+}
+
+// writeCfgAtomic writes a config file by way of `write` without ever leaving
+// the config file partially written or truncated on error
+func writeCfgAtomic(cfgPath string, mode os.FileMode, owner string, write func(io.Writer) error) error {
+	p, err := writeCfgTemp(cfgPath, mode, owner, write)
+	if err != nil {
+		return err
+	}
+	return p.commit()
+}
+
+// writeCfgTemp writes a temp file in the same directory as `cfgPath` by way of
+// `write` then syncs it to disk. The temp file takes on `mode` and `owner`
+// which default to the mode and owner of an existing config file. When
+// `cfgPath` is a symlink, the file it points to is written instead.
+func writeCfgTemp(cfgPath string, mode os.FileMode, owner string, write func(io.Writer) error) (p *pendingCfg, err error) {
+	if cfgPath, err = resolveCfgPath(cfgPath); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(cfgPath), "."+filepath.Base(cfgPath)+".")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	// use buffered writer to reduce the number of writes to the temp file
+	w := bufio.NewWriterSize(f, writeBufferSize)
+	if err = write(w); err != nil {
+		return nil, err
+	}
+	if err = w.Flush(); err != nil {
+		return nil, err
+	}
+	if err = f.Sync(); err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	if err = inheritCfgPerms(f.Name(), cfgPath, mode); err != nil {
+		return nil, err
+	}
+	if err = setCfgPerms(f.Name(), mode, owner); err != nil {
+		return nil, err
+	}
+	return &pendingCfg{tmpPath: f.Name(), cfgPath: cfgPath, mode: mode, owner: owner}, nil
+}
+
+// resolveCfgPath returns `cfgPath` with any symlink chain of its final element
+// followed, including to a target that doesn't exist yet, so renaming over
+// the result never replaces a symlink with a regular file
+func resolveCfgPath(cfgPath string) (string, error) {
+	for i := 0; i < 255; i++ {
+		info, err := os.Lstat(cfgPath)
+		if os.IsNotExist(err) {
+			return cfgPath, nil
+		} else if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return cfgPath, nil
+		}
+		target, err := os.Readlink(cfgPath)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(cfgPath), target)
+		}
+		cfgPath = target
+	}
+	return "", errors.New(cfgPath + ": too many levels of symbolic links")
+}
+
+// commit renames the temp file over the config file and syncs the directory.
+// A config file that can't be renamed over because it is a mount point (i.e.
+// a docker bind mount or kubernetes subPath) is written in place instead.
+func (p *pendingCfg) commit() error {
+	if err := os.Rename(p.tmpPath, p.cfgPath); err != nil {
+		if isMountErr(err) {
+			return p.commitInPlace()
+		}
+		os.Remove(p.tmpPath)
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(p.cfgPath)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// commitInPlace truncates and writes the config file with the contents of the
+// temp file then removes the temp file. This is not atomic.
+func (p *pendingCfg) commitInPlace() error {
+	defer os.Remove(p.tmpPath)
+	src, err := os.Open(p.tmpPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(p.cfgPath, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return setCfgPerms(p.cfgPath, p.mode, p.owner)
+}
+
+// isMountErr reports whether a rename failed because the target is a mount
+// point or on another filesystem
+func isMountErr(err error) bool {
+	if linkErr, ok := err.(*os.LinkError); ok {
+		err = linkErr.Err
+	}
+	return err == syscall.EBUSY || err == syscall.EXDEV
+}
+
+// discard removes the temp file
+func (p *pendingCfg) discard() {
+	os.Remove(p.tmpPath)
+}
+
+// backupCfg copies the current contents, mode and owner of the config file
+// of `p` to a temp file which, once `p` is committed, restores the config file
+// when committed itself. The backup is nil when the config file doesn't exist.
+func (p *pendingCfg) backupCfg() (*pendingCfg, error) {
+	src, err := os.Open(p.cfgPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return writeCfgTemp(p.cfgPath, 0, "", func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+}
+
+// rollback restores the config file of a committed `p` from `backup` or
+// removes it when it didn't exist before
+func (p *pendingCfg) rollback(backup *pendingCfg) error {
+	if backup == nil {
+		return os.Remove(p.cfgPath)
+	}
+	return backup.commit()
+}
+
+// inheritCfgPerms sets the mode and owner of an existing config file on the
+// temp file. When the config file doesn't exist, the temp file gets the
+// default config mode unless `mode` is set.
+func inheritCfgPerms(tmpPath, cfgPath string, mode os.FileMode) error {
+	info, err := os.Stat(cfgPath)
+	if os.IsNotExist(err) {
+		if mode == 0 {
+			return os.Chmod(tmpPath, defaultCfgMode)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		// only privileged users can give away files so failure is expected
+		// when running unprivileged
+		if err = os.Lchown(tmpPath, int(st.Uid), int(st.Gid)); err != nil && !os.IsPermission(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// env vars for consul source config which are the same as the consul cli
+const (
+	envKeyConsulAddr  = "CONSUL_HTTP_ADDR"
+	envKeyConsulToken = "CONSUL_HTTP_TOKEN"
+)
+
+// DefaultConsulAddr is the consul address used when CONSUL_HTTP_ADDR is not set
+const DefaultConsulAddr = "http://127.0.0.1:8500"
+
+// DefaultConsulKeySep is the variable name separator consul key path segments
+// are joined with by default
+const DefaultConsulKeySep = "_"
+
+// ConsulSource loads variables from every key under a consul KV prefix where
+// the key path relative to the prefix, with "/" replaced by `KeySep`, is the
+// variable name i.e. with prefix "app" the key "app/db/host" is "db_host".
+// Setting `KeySep` to the nested variable delimiter loads keys as nested maps.
+type ConsulSource struct {
+	Addr   string
+	Prefix string
+	Token  string
+	KeySep string
+	Client *http.Client
+}
+
+// NewConsulSource returns a consul source for `prefix` configured from the
+// CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN env vars
+func NewConsulSource(prefix string, env *Env) *ConsulSource {
+	return &ConsulSource{
+		Addr:   env.Find(envKeyConsulAddr),
+		Prefix: prefix,
+		Token:  env.Find(envKeyConsulToken),
+		KeySep: DefaultConsulKeySep,
+	}
+}
+
+// Load implements the Source interface
+func (s *ConsulSource) Load() (map[string]string, error) {
+	var addr = s.Addr
+	if len(addr) == 0 {
+		addr = DefaultConsulAddr
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	var prefix = strings.Trim(s.Prefix, "/")
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/kv/"+consulKeyPath(prefix)+"?recurse=true", nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("consul: ", err))
+	}
+	if len(s.Token) != 0 {
+		req.Header.Set("X-Consul-Token", s.Token)
+	}
+	var client = s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("consul: ", err))
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("consul: ", err))
+	}
+	vars := make(map[string]string)
+	// consul responds not found when no keys exist under the prefix
+	if resp.StatusCode == http.StatusNotFound {
+		return vars, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.New(fmt.Sprint("consul: ", prefix, ": ", resp.Status, ": ", strings.TrimSpace(string(data))))
+	}
+	var pairs []struct {
+		Key   string
+		Value *string // base64 encoded or null
+	}
+	if err = json.NewDecoder(bytes.NewReader(data)).Decode(&pairs); err != nil {
+		return nil, errors.New(fmt.Sprint("consul: ", err))
+	}
+	var keySep = s.KeySep
+	if len(keySep) == 0 {
+		keySep = DefaultConsulKeySep
+	}
+	for _, pair := range pairs {
+		var name = pair.Key
+		if len(prefix) != 0 {
+			// consul prefixes aren't path aware so "app" also matches "apple"
+			if !strings.HasPrefix(pair.Key, prefix+"/") {
+				continue
+			}
+			name = strings.TrimPrefix(pair.Key, prefix+"/")
+		}
+		// skip folder keys
+		if len(name) == 0 || strings.HasSuffix(name, "/") {
+			continue
+		}
+		var val []byte
+		if pair.Value != nil {
+			if val, err = base64.StdEncoding.DecodeString(*pair.Value); err != nil {
+				return nil, errors.New(fmt.Sprint("consul: ", pair.Key, ": ", err))
+			}
+		}
+		vars[strings.Replace(name, "/", keySep, -1)] = string(val)
+	}
+	return vars, nil
+}
+
+// consulKeyPath escapes each segment of a consul key path for use in a URL
+func consulKeyPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,62 @@
+package redact
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsulSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("ACL not found"))
+			return
+		}
+		if r.URL.Path != "/v1/kv/app" || r.URL.Query().Get("recurse") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// db/host=db, db/port=5432, name=app, tls/ folder, apple/ unrelated
+		w.Write([]byte(`[
+			{"Key": "app/", "Value": null},
+			{"Key": "app/db/host", "Value": "ZGI="},
+			{"Key": "app/db/port", "Value": "NTQzMg=="},
+			{"Key": "app/name", "Value": "YXBw"},
+			{"Key": "app/tls/", "Value": null},
+			{"Key": "apple/name", "Value": "YXBwbGU="}
+		]`))
+	}))
+	defer server.Close()
+	source := &ConsulSource{Addr: server.URL, Prefix: "/app/", Token: "token"}
+	vars, err := source.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"db_host": "db", "db_port": "5432", "name": "app"}
+	if len(vars) != len(expected) {
+		t.Error("Expected ", len(expected), " vars, got: ", vars)
+	}
+	for name, val := range expected {
+		if vars[name] != val {
+			t.Errorf("Expected %s to be %q, got: %q", name, val, vars[name])
+		}
+	}
+	// nested var delimiter
+	source.KeySep = "__"
+	if vars, err = source.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if vars["db__host"] != "db" {
+		t.Error("Expected db__host to be \"db\", got: ", vars)
+	}
+	// missing prefix loads no vars
+	source.Prefix = "missing"
+	if vars, err = source.Load(); err != nil || len(vars) != 0 {
+		t.Error("Expected no vars and no error, got: ", vars, err)
+	}
+	source.Token = "invalid"
+	if _, err = source.Load(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
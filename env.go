@@ -2,7 +2,12 @@ package redact
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -10,22 +15,65 @@ const (
 	// prefix for reserved env vars used to configure redact itself
 	envKeyPrefix = "RDCT_"
 	// reserved env vars for redact config
-	envKeyDefaultTplEngine = "DEFAULT_TPL_ENGINE" // "fallback" value
-	envKeyDefaultTplPath   = "DEFAULT_TPL_PATH"   // "fallback" value
-	envKeyDefaultCfgPath   = "DEFAULT_CFG_PATH"   // "fallback" value
-	envKeyTplEngine        = "TPL_ENGINE"
-	envKeyTplPath          = "TPL_PATH"
-	envKeyCfgPath          = "CFG_PATH"
+	envKeyDefaultTplEngine       = "DEFAULT_TPL_ENGINE"               // "fallback" value
+	envKeyDefaultTplPath         = "DEFAULT_TPL_PATH"                 // "fallback" value
+	envKeyDefaultCfgPath         = "DEFAULT_CFG_PATH"                 // "fallback" value
+	envKeyDefaultManifest        = "DEFAULT_MANIFEST"                 // "fallback" value
+	envKeyDefaultCfgMode         = "DEFAULT_CFG_MODE"                 // "fallback" value
+	envKeyDefaultCfgOwner        = "DEFAULT_CFG_OWNER"                // "fallback" value
+	envKeyDefaultStrict          = "DEFAULT_STRICT"                   // "fallback" value
+	envKeyDefaultCoerce          = "DEFAULT_COERCE"                   // "fallback" value
+	envKeyDefaultNestDelim       = "DEFAULT_NEST_DELIM"               // "fallback" value
+	envKeyDefaultFileVars        = "DEFAULT_FILE_VARS"                // "fallback" value
+	envKeyDefaultFileRoots       = "DEFAULT_FILE_ROOTS"               // "fallback" value
+	envKeyDefaultPreRenderMode   = "DEFAULT_PRE_RENDER_MODE"          // "fallback" value
+	envKeyDefaultPreRender       = "DEFAULT_PRE_RENDER"               // "fallback" value
+	envKeyDefaultPreRenderDir    = "DEFAULT_PRE_RENDER_DIR"           // "fallback" value
+	envKeyDefaultPostRender      = "DEFAULT_POST_RENDER"              // "fallback" value
+	envKeyDefaultPreRenderAllow  = "DEFAULT_PRE_RENDER_ALLOW"         // "fallback" value
+	envKeyDefaultPreRenderDeny   = "DEFAULT_PRE_RENDER_DENY"          // "fallback" value
+	envKeyDefaultPreRenderValues = "DEFAULT_PRE_RENDER_REPORT_VALUES" // "fallback" value
+	envKeyDefaultPreRenderMask   = "DEFAULT_PRE_RENDER_MASK"          // "fallback" value
+	envKeyTplEngine              = "TPL_ENGINE"
+	envKeyTplPath                = "TPL_PATH"
+	envKeyCfgPath                = "CFG_PATH"
+	envKeyManifest               = "MANIFEST"
+	envKeyCfgMode                = "CFG_MODE"
+	envKeyCfgOwner               = "CFG_OWNER"
+	envKeyStrict                 = "STRICT"
+	envKeyCoerce                 = "COERCE"
+	envKeyNestDelim              = "NEST_DELIM"
+	envKeyFileVars               = "FILE_VARS"
+	envKeyFileRoots              = "FILE_ROOTS"
+	envKeyPreRenderMode          = "PRE_RENDER_MODE"
+	envKeyPreRender              = "PRE_RENDER"
+	envKeyPreRenderDir           = "PRE_RENDER_DIR"
+	envKeyPostRender             = "POST_RENDER"
+	envKeyPreRenderAllow         = "PRE_RENDER_ALLOW"
+	envKeyPreRenderDeny          = "PRE_RENDER_DENY"
+	envKeyPreRenderValues        = "PRE_RENDER_REPORT_VALUES"
+	envKeyPreRenderMask          = "PRE_RENDER_MASK"
+	// prefix for declared template var types i.e. RDCT_TYPE_my_var=list
+	envKeyTypePrefix = "TYPE_"
+	// prefix for patch sets i.e. RDCT_SET__server__port=8080
+	envKeySetPrefix = "SET__"
+	// key path separator for patch sets
+	envKeySetSep = "__"
 )
 
 // singleton instance
 var envInstance *Env
 
-// environToMap returns a map of all env variables
+// environToMap returns a map of all env variables where each is split on its
+// first "=" so values may contain "=" and newlines
 func environToMap(envs []string) map[string]string {
 	envsmap := make(map[string]string)
 	for _, s := range envs {
-		pair := strings.Split(s, "=")
+		pair := strings.SplitN(s, "=", 2)
+		if len(pair) == 1 {
+			envsmap[pair[0]] = ""
+			continue
+		}
 		envsmap[pair[0]] = pair[1]
 	}
 	return envsmap
@@ -44,6 +92,12 @@ func GetEnvInstance() *Env {
 	return envInstance
 }
 
+// ResetEnvInstance discards the singleton instance of Env so the next call to
+// `GetEnvInstance` reloads the env vars (i.e. before re-rendering)
+func ResetEnvInstance() {
+	envInstance = nil
+}
+
 // Find returns an env var value by key
 func (e *Env) Find(key string) string {
 	return e.env[key]
@@ -83,6 +137,21 @@ func (e *Env) Merge(env map[string]string) {
 	}
 }
 
+// Environ returns the env vars in the form KEY=VALUE sorted by name
+func (e *Env) Environ() []string {
+	var environ []string
+	for name, val := range e.env {
+		environ = append(environ, name+"="+val)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// Unset removes the env var `name`
+func (e *Env) Unset(name string) {
+	delete(e.env, name)
+}
+
 // ResolveTplEngine returns the value for the template engine in the resolution
 // order defined by `resolveDefault` with an empty override param
 func (e *Env) ResolveTplEngine() string {
@@ -131,6 +200,512 @@ func (e *Env) ResolveCfgPathDefault(defaultPath string) string {
 	)
 }
 
+// ResolveCfgMode returns the value for the config file mode in the resolution
+// order defined by `resolveDefault` with an empty override param
+func (e *Env) ResolveCfgMode() (os.FileMode, error) {
+	return e.ResolveCfgModeDefault("")
+}
+
+// ResolveCfgModeDefault returns the value for the config file mode in the
+// resolution order defined by `resolveDefault` where an empty value results in
+// a zero mode
+func (e *Env) ResolveCfgModeDefault(defaultMode string) (os.FileMode, error) {
+	return parseFileMode(e.resolveDefault(
+		envKeyPrefix+envKeyCfgMode,
+		envKeyPrefix+envKeyDefaultCfgMode,
+		defaultMode,
+	))
+}
+
+// ResolveCfgOwner returns the value for the config file owner in the
+// resolution order defined by `resolveDefault` with an empty override param
+func (e *Env) ResolveCfgOwner() string {
+	return e.ResolveCfgOwnerDefault("")
+}
+
+// ResolveCfgOwnerDefault returns the value for the config file owner in the
+// resolution order defined by `resolveDefault`
+func (e *Env) ResolveCfgOwnerDefault(defaultOwner string) string {
+	return e.resolveDefault(
+		envKeyPrefix+envKeyCfgOwner,
+		envKeyPrefix+envKeyDefaultCfgOwner,
+		defaultOwner,
+	)
+}
+
+// ResolveStrict returns whether strict rendering is enabled in the resolution
+// order defined by `resolveDefault` with a false override param
+func (e *Env) ResolveStrict() bool {
+	return e.ResolveStrictDefault(false)
+}
+
+// ResolveStrictDefault returns whether strict rendering is enabled in the
+// resolution order defined by `resolveDefault` where a false `defaultStrict`
+// is treated as empty
+func (e *Env) ResolveStrictDefault(defaultStrict bool) bool {
+	return e.resolveBoolDefault(
+		envKeyPrefix+envKeyStrict,
+		envKeyPrefix+envKeyDefaultStrict,
+		defaultStrict,
+	)
+}
+
+// ResolveCoerce returns whether template vars are coerced to typed values in
+// the resolution order defined by `resolveDefault` with a false override param
+func (e *Env) ResolveCoerce() bool {
+	return e.ResolveCoerceDefault(false)
+}
+
+// ResolveCoerceDefault returns whether template vars are coerced to typed
+// values in the resolution order defined by `resolveDefault` where a false
+// `defaultCoerce` is treated as empty
+func (e *Env) ResolveCoerceDefault(defaultCoerce bool) bool {
+	return e.resolveBoolDefault(
+		envKeyPrefix+envKeyCoerce,
+		envKeyPrefix+envKeyDefaultCoerce,
+		defaultCoerce,
+	)
+}
+
+// ResolveNestDelim returns the value for the nested var name delimiter in the
+// resolution order defined by `resolveDefault` with an empty override param
+func (e *Env) ResolveNestDelim() string {
+	return e.ResolveNestDelimDefault("")
+}
+
+// ResolveNestDelimDefault returns the value for the nested var name delimiter
+// in the resolution order defined by `resolveDefault`
+func (e *Env) ResolveNestDelimDefault(defaultDelim string) string {
+	return e.resolveDefault(
+		envKeyPrefix+envKeyNestDelim,
+		envKeyPrefix+envKeyDefaultNestDelim,
+		defaultDelim,
+	)
+}
+
+// ResolvePreRenderMode returns the value for the pre-render script mode in the
+// resolution order defined by `resolveDefault` with an empty override param
+func (e *Env) ResolvePreRenderMode() string {
+	return e.ResolvePreRenderModeDefault("")
+}
+
+// ResolvePreRenderModeDefault returns the value for the pre-render script mode
+// in the resolution order defined by `resolveDefault`
+func (e *Env) ResolvePreRenderModeDefault(defaultMode string) string {
+	return e.resolveDefault(
+		envKeyPrefix+envKeyPreRenderMode,
+		envKeyPrefix+envKeyDefaultPreRenderMode,
+		defaultMode,
+	)
+}
+
+// ResolvePreRenderDir returns the value for the pre-render hooks dir in the
+// resolution order defined by `resolveDefault` with an empty override param
+func (e *Env) ResolvePreRenderDir() string {
+	return e.ResolvePreRenderDirDefault("")
+}
+
+// ResolvePreRenderDirDefault returns the value for the pre-render hooks dir in
+// the resolution order defined by `resolveDefault`
+func (e *Env) ResolvePreRenderDirDefault(defaultDir string) string {
+	return e.resolveDefault(
+		envKeyPrefix+envKeyPreRenderDir,
+		envKeyPrefix+envKeyDefaultPreRenderDir,
+		defaultDir,
+	)
+}
+
+// ResolvePreRenderAllow returns the var name globs pre-render scripts may set
+// in the resolution order defined by `resolveDefault` with an empty override
+// param
+func (e *Env) ResolvePreRenderAllow() ([]string, error) {
+	return e.ResolvePreRenderAllowDefault(nil)
+}
+
+// ResolvePreRenderAllowDefault returns the var name globs pre-render scripts
+// may set in the resolution order defined by `resolveDefault` where env var
+// values are comma separated or an error if a glob is malformed
+func (e *Env) ResolvePreRenderAllowDefault(defaultAllow []string) ([]string, error) {
+	allow := splitList(e.resolveDefault(
+		envKeyPrefix+envKeyPreRenderAllow,
+		envKeyPrefix+envKeyDefaultPreRenderAllow,
+		strings.Join(defaultAllow, ","),
+	))
+	return allow, validateGlobs(allow)
+}
+
+// ResolvePreRenderDeny returns the var name globs pre-render scripts may not
+// set in the resolution order defined by `resolveDefault` with an empty
+// override param
+func (e *Env) ResolvePreRenderDeny() ([]string, error) {
+	return e.ResolvePreRenderDenyDefault(nil)
+}
+
+// ResolvePreRenderDenyDefault returns the var name globs pre-render scripts
+// may not set in the resolution order defined by `resolveDefault` where env
+// var values are comma separated or an error if a glob is malformed
+func (e *Env) ResolvePreRenderDenyDefault(defaultDeny []string) ([]string, error) {
+	deny := splitList(e.resolveDefault(
+		envKeyPrefix+envKeyPreRenderDeny,
+		envKeyPrefix+envKeyDefaultPreRenderDeny,
+		strings.Join(defaultDeny, ","),
+	))
+	return deny, validateGlobs(deny)
+}
+
+// ResolvePreRenderReportValues returns whether pre-render reports include
+// variable values in the resolution order defined by `resolveDefault` with a
+// false override param
+func (e *Env) ResolvePreRenderReportValues() bool {
+	return e.ResolvePreRenderReportValuesDefault(false)
+}
+
+// ResolvePreRenderReportValuesDefault returns whether pre-render reports
+// include variable values in the resolution order defined by `resolveDefault`
+// where a false `defaultValues` is treated as empty
+func (e *Env) ResolvePreRenderReportValuesDefault(defaultValues bool) bool {
+	return e.resolveBoolDefault(
+		envKeyPrefix+envKeyPreRenderValues,
+		envKeyPrefix+envKeyDefaultPreRenderValues,
+		defaultValues,
+	)
+}
+
+// ResolvePreRenderMask returns the var name parts whose values are masked in
+// pre-render reports in the resolution order defined by `resolveDefault` with
+// an empty override param
+func (e *Env) ResolvePreRenderMask() []string {
+	return e.ResolvePreRenderMaskDefault(nil)
+}
+
+// ResolvePreRenderMaskDefault returns the var name parts whose values are
+// masked in pre-render reports in the resolution order defined by
+// `resolveDefault` where env var values are comma separated
+func (e *Env) ResolvePreRenderMaskDefault(defaultMask []string) []string {
+	return splitList(e.resolveDefault(
+		envKeyPrefix+envKeyPreRenderMask,
+		envKeyPrefix+envKeyDefaultPreRenderMask,
+		strings.Join(defaultMask, ","),
+	))
+}
+
+// ResolvePreRenderHooks returns the pre-render hooks declared with indexed env
+// vars in the form RDCT_PRE_RENDER_N (or RDCT_DEFAULT_PRE_RENDER_N) in index
+// order where each is resolved in the order defined by `resolveDefault`
+func (e *Env) ResolvePreRenderHooks() ([]PreRenderHook, error) {
+	var hooks []PreRenderHook
+	for _, i := range e.indexes(envKeyPrefix+envKeyPreRender+"_", envKeyPrefix+envKeyDefaultPreRender+"_") {
+		var key = indexedKey(envKeyPrefix+envKeyPreRender, i)
+		var spec = e.resolveDefault(key, indexedKey(envKeyPrefix+envKeyDefaultPreRender, i), "")
+		if len(strings.TrimSpace(spec)) == 0 {
+			continue
+		}
+		hook, err := ParsePreRenderHook(spec)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint(key, ": ", err))
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// ResolvePostRenderHooks returns the post-render hooks declared with indexed
+// env vars in the form RDCT_POST_RENDER_N (or RDCT_DEFAULT_POST_RENDER_N) in
+// index order where each is resolved in the order defined by `resolveDefault`
+func (e *Env) ResolvePostRenderHooks() ([]PostRenderHook, error) {
+	var hooks []PostRenderHook
+	for _, i := range e.indexes(envKeyPrefix+envKeyPostRender+"_", envKeyPrefix+envKeyDefaultPostRender+"_") {
+		var key = indexedKey(envKeyPrefix+envKeyPostRender, i)
+		var spec = e.resolveDefault(key, indexedKey(envKeyPrefix+envKeyDefaultPostRender, i), "")
+		if len(strings.TrimSpace(spec)) == 0 {
+			continue
+		}
+		hook, err := ParsePostRenderHook(spec)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint(key, ": ", err))
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// ResolveFileVarsEnabled returns whether `_FILE` env vars are resolved in the
+// resolution order defined by `resolveDefault` with a false override param
+func (e *Env) ResolveFileVarsEnabled() bool {
+	return e.ResolveFileVarsEnabledDefault(false)
+}
+
+// ResolveFileVarsEnabledDefault returns whether `_FILE` env vars are resolved
+// in the resolution order defined by `resolveDefault` where a false
+// `defaultEnabled` is treated as empty. A list of var names is also enabled.
+func (e *Env) ResolveFileVarsEnabledDefault(defaultEnabled bool) bool {
+	var override string
+	if defaultEnabled {
+		override = "true"
+	}
+	val := e.resolveDefault(
+		envKeyPrefix+envKeyFileVars,
+		envKeyPrefix+envKeyDefaultFileVars,
+		override,
+	)
+	if enabled, err := strconv.ParseBool(val); err == nil {
+		return enabled
+	}
+	return len(splitList(val)) != 0
+}
+
+// ResolveFileVarNames returns the var names whose `_FILE` env vars are
+// resolved in the resolution order defined by `resolveDefault` with an empty
+// override param
+func (e *Env) ResolveFileVarNames() []string {
+	return e.ResolveFileVarNamesDefault(nil)
+}
+
+// ResolveFileVarNamesDefault returns the var names whose `_FILE` env vars are
+// resolved in the resolution order defined by `resolveDefault` where the var
+// names are a comma separated list. Empty (all `_FILE` env vars) if resolved
+// to a boolean.
+func (e *Env) ResolveFileVarNamesDefault(defaultNames []string) []string {
+	val := e.resolveDefault(
+		envKeyPrefix+envKeyFileVars,
+		envKeyPrefix+envKeyDefaultFileVars,
+		strings.Join(defaultNames, ","),
+	)
+	if _, err := strconv.ParseBool(val); err == nil {
+		return nil
+	}
+	return splitList(val)
+}
+
+// ResolveFileRoots returns the dirs template file functions may access in the
+// resolution order defined by `resolveDefault` with an empty override param
+func (e *Env) ResolveFileRoots() []string {
+	return e.ResolveFileRootsDefault(nil)
+}
+
+// ResolveFileRootsDefault returns the dirs template file functions may access
+// in the resolution order defined by `resolveDefault` where env var values are
+// lists separated by the os path list separator (":" on linux)
+func (e *Env) ResolveFileRootsDefault(defaultRoots []string) []string {
+	roots := e.resolveDefault(
+		envKeyPrefix+envKeyFileRoots,
+		envKeyPrefix+envKeyDefaultFileRoots,
+		strings.Join(defaultRoots, string(filepath.ListSeparator)),
+	)
+	if len(roots) == 0 {
+		return nil
+	}
+	return filepath.SplitList(roots)
+}
+
+// ResolveVarTypes returns the declared template var types by var name where
+// types are declared with env vars in the form RDCT_TYPE_<var name>=<type>
+func (e *Env) ResolveVarTypes() map[string]string {
+	var types = make(map[string]string)
+	for k, v := range e.env {
+		if name := strings.TrimPrefix(k, envKeyPrefix+envKeyTypePrefix); name != k && len(name) != 0 {
+			types[name] = v
+		}
+	}
+	return types
+}
+
+// ResolvePatchSets returns the patch sets declared with env vars in the form
+// RDCT_SET__<key>__<key>=<value> sorted by env var name
+func (e *Env) ResolvePatchSets() []PatchSet {
+	var names []string
+	for name := range e.env {
+		if strings.HasPrefix(name, envKeyPrefix+envKeySetPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var sets []PatchSet
+	for _, name := range names {
+		path := strings.Split(strings.TrimPrefix(name, envKeyPrefix+envKeySetPrefix), envKeySetSep)
+		if hasEmptyString(path) {
+			continue
+		}
+		sets = append(sets, PatchSet{Path: path, Value: e.env[name]})
+	}
+	return sets
+}
+
+// ResolveManifestPath returns the value for the manifest path in the
+// resolution order defined by `resolveDefault` with an empty override param
+func (e *Env) ResolveManifestPath() string {
+	return e.ResolveManifestPathDefault("")
+}
+
+// ResolveManifestPathDefault returns the value for the manifest path in the
+// resolution order defined by `resolveDefault`
+func (e *Env) ResolveManifestPathDefault(defaultPath string) string {
+	return e.resolveDefault(
+		envKeyPrefix+envKeyManifest,
+		envKeyPrefix+envKeyDefaultManifest,
+		defaultPath,
+	)
+}
+
+// ResolveTargets returns the render targets declared with indexed env vars
+// (i.e. RDCT_TPL_PATH_1 and RDCT_CFG_PATH_1) in ascending index order. Each
+// indexed var resolves the same as its non-indexed counterpart and targets
+// without an indexed engine use `defaultEngine`
+func (e *Env) ResolveTargets(defaultEngine string) ([]RenderTarget, error) {
+	return e.ResolveTargetsDefault(nil, defaultEngine)
+}
+
+// ResolveTargetsDefault returns the render targets as defined by
+// `ResolveTargets` where `defaults` are the override values for indexes 1
+// through len(defaults) in the resolution order defined by `resolveDefault`
+func (e *Env) ResolveTargetsDefault(defaults []RenderTarget, defaultEngine string) ([]RenderTarget, error) {
+	var targets []RenderTarget
+	for _, i := range e.targetIndexes(len(defaults)) {
+		var d RenderTarget
+		if i <= len(defaults) {
+			d = defaults[i-1]
+		}
+		tplPath := e.resolveDefault(
+			indexedKey(envKeyPrefix+envKeyTplPath, i),
+			indexedKey(envKeyPrefix+envKeyDefaultTplPath, i),
+			d.TplPath,
+		)
+		if len(tplPath) == 0 {
+			return nil, errors.New("empty " + indexedKey(envKeyPrefix+envKeyDefaultTplPath, i) +
+				" or " + indexedKey(envKeyPrefix+envKeyTplPath, i))
+		}
+		cfgPath := e.resolveDefault(
+			indexedKey(envKeyPrefix+envKeyCfgPath, i),
+			indexedKey(envKeyPrefix+envKeyDefaultCfgPath, i),
+			d.CfgPath,
+		)
+		if len(cfgPath) == 0 {
+			return nil, errors.New("empty " + indexedKey(envKeyPrefix+envKeyDefaultCfgPath, i) +
+				" or " + indexedKey(envKeyPrefix+envKeyCfgPath, i))
+		}
+		engine := e.resolveDefault(
+			indexedKey(envKeyPrefix+envKeyTplEngine, i),
+			indexedKey(envKeyPrefix+envKeyDefaultTplEngine, i),
+			d.Engine,
+		)
+		if len(engine) == 0 {
+			engine = defaultEngine
+		}
+		var defaultMode string
+		if d.Mode != 0 {
+			defaultMode = fmt.Sprintf("%#o", d.Mode)
+		}
+		mode, err := parseFileMode(e.resolveDefault(
+			indexedKey(envKeyPrefix+envKeyCfgMode, i),
+			indexedKey(envKeyPrefix+envKeyDefaultCfgMode, i),
+			defaultMode,
+		))
+		if err != nil {
+			return nil, errors.New(fmt.Sprint(indexedKey(envKeyPrefix+envKeyCfgMode, i), ": ", err))
+		}
+		owner := e.resolveDefault(
+			indexedKey(envKeyPrefix+envKeyCfgOwner, i),
+			indexedKey(envKeyPrefix+envKeyDefaultCfgOwner, i),
+			d.Owner,
+		)
+		targets = append(targets, RenderTarget{
+			TplPath: tplPath,
+			CfgPath: cfgPath,
+			Engine:  engine,
+			Mode:    mode,
+			Owner:   owner,
+		})
+	}
+	return targets, nil
+}
+
+// targetIndexes returns the sorted unique indexes of all indexed template and
+// config path env vars including indexes 1 through `n`
+func (e *Env) targetIndexes(n int) []int {
+	var seen = make(map[int]bool)
+	var indexes []int
+	for i := 1; i <= n; i++ {
+		seen[i] = true
+		indexes = append(indexes, i)
+	}
+	for _, i := range e.indexes(
+		envKeyPrefix+envKeyTplPath+"_",
+		envKeyPrefix+envKeyDefaultTplPath+"_",
+		envKeyPrefix+envKeyCfgPath+"_",
+		envKeyPrefix+envKeyDefaultCfgPath+"_",
+	) {
+		if !seen[i] {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// indexes returns the sorted unique indexes of all env vars named with one of
+// the `keys` followed by an index of 1 or more
+func (e *Env) indexes(keys ...string) []int {
+	var seen = make(map[int]bool)
+	var indexes []int
+	for name := range e.env {
+		for _, key := range keys {
+			if !strings.HasPrefix(name, key) {
+				continue
+			}
+			i, err := strconv.Atoi(strings.TrimPrefix(name, key))
+			if err != nil || i < 1 || seen[i] {
+				continue
+			}
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// splitList returns the non-empty trimmed items of the comma separated `s`
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validateGlobs returns an error for the first malformed glob in `globs`
+func validateGlobs(globs []string) error {
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return errors.New(fmt.Sprint("invalid glob ", glob, ": ", err))
+		}
+	}
+	return nil
+}
+
+// parseBool returns the boolean value of `s` where invalid values are false
+func parseBool(s string) bool {
+	b, _ := strconv.ParseBool(s)
+	return b
+}
+
+// indexedKey returns the env var name `key` suffixed with index `i`
+func indexedKey(key string, i int) string {
+	return fmt.Sprintf("%s_%d", key, i)
+}
+
+// resolveBoolDefault returns a boolean value in the resolution order defined
+// by `resolveDefault` where a false `defaultOverride` is treated as empty
+func (e *Env) resolveBoolDefault(varName, defaultVarName string, defaultOverride bool) bool {
+	var override string
+	if defaultOverride {
+		override = "true"
+	}
+	return parseBool(e.resolveDefault(varName, defaultVarName, override))
+}
+
 // resolveDefault returns a value in the following order: returns the value of
 // the environment variable specified by `varName` if not empty. Otherwise,
 // returns the value of the `defaultOverride` param if not empty. If
@@ -2,7 +2,9 @@ package redact
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -24,6 +26,14 @@ func TestEnvironToMap(t *testing.T) {
 	if _, ok := envs["test_app_var"]; !ok {
 		t.Error("could not find test_app_var in env map")
 	}
+	// values are split on the first "="
+	envs = environToMap([]string{"JAVA_OPTS=-Dfoo=bar", "B64=Zm9vYg==", "EMPTY=", "NO_VALUE", "PEM=a\nb"})
+	expected := map[string]string{"JAVA_OPTS": "-Dfoo=bar", "B64": "Zm9vYg==", "EMPTY": "", "NO_VALUE": "", "PEM": "a\nb"}
+	for name, val := range expected {
+		if actual, ok := envs[name]; !ok || actual != val {
+			t.Errorf("Expected %s to be %q, got: %q", name, val, actual)
+		}
+	}
 }
 
 func TestEnvFind(t *testing.T) {
@@ -178,3 +188,237 @@ func TestResolveCfgPathDefault(t *testing.T) {
 		t.Error("expected path to be /path/to/override/config, got: ", path)
 	}
 }
+
+func TestEnvResolveTargets(t *testing.T) {
+	os.Setenv("RDCT_TPL_PATH_2", "/path/to/template2")
+	os.Setenv("RDCT_CFG_PATH_2", "/path/to/config2")
+	os.Setenv("RDCT_DEFAULT_TPL_PATH_1", "/path/to/template1")
+	os.Setenv("RDCT_DEFAULT_CFG_PATH_1", "/path/to/config1")
+	os.Setenv("RDCT_TPL_ENGINE_1", "mustache")
+	defer func() {
+		for _, k := range []string{"RDCT_TPL_PATH_2", "RDCT_CFG_PATH_2", "RDCT_DEFAULT_TPL_PATH_1",
+			"RDCT_DEFAULT_CFG_PATH_1", "RDCT_TPL_ENGINE_1"} {
+			os.Unsetenv(k)
+		}
+		envInstance = nil
+	}()
+	envInstance = nil
+	targets, err := GetEnvInstance().ResolveTargets("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatal("expected 2 targets, got: ", len(targets))
+	}
+	expected := []RenderTarget{
+		{TplPath: "/path/to/template1", CfgPath: "/path/to/config1", Engine: "mustache"},
+		{TplPath: "/path/to/template2", CfgPath: "/path/to/config2", Engine: "go"},
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Errorf("expected target %d to be %v, got: %v", i+1, expected[i], targets[i])
+		}
+	}
+	os.Unsetenv("RDCT_CFG_PATH_2")
+	envInstance = nil
+	if _, err = GetEnvInstance().ResolveTargets("go"); err == nil {
+		t.Error("expected err to be error for missing config path, got: nil")
+	}
+}
+
+func TestEnvResolveCfgModeDefault(t *testing.T) {
+	envInstance = nil
+	mode, err := GetEnvInstance().ResolveCfgModeDefault("0640")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != 0640 {
+		t.Error("expected mode to be 0640, got: ", mode)
+	}
+	os.Setenv("RDCT_CFG_MODE", "0600")
+	defer os.Unsetenv("RDCT_CFG_MODE")
+	envInstance = nil
+	if mode, err = GetEnvInstance().ResolveCfgModeDefault("0640"); err != nil {
+		t.Fatal(err)
+	}
+	if mode != 0600 {
+		t.Error("expected mode to be 0600, got: ", mode)
+	}
+	os.Setenv("RDCT_CFG_MODE", "rw-r--r--")
+	envInstance = nil
+	if _, err = GetEnvInstance().ResolveCfgModeDefault("0640"); err == nil {
+		t.Error("expected err to be error, got: nil")
+	}
+}
+
+func TestEnvResolveCfgOwnerDefault(t *testing.T) {
+	envInstance = nil
+	owner := GetEnvInstance().ResolveCfgOwnerDefault("nobody")
+	if owner != "nobody" {
+		t.Error("expected owner to be nobody, got: ", owner)
+	}
+	os.Setenv("RDCT_CFG_OWNER", "root:root")
+	defer os.Unsetenv("RDCT_CFG_OWNER")
+	envInstance = nil
+	owner = GetEnvInstance().ResolveCfgOwnerDefault("nobody")
+	if owner != "root:root" {
+		t.Error("expected owner to be root:root, got: ", owner)
+	}
+}
+
+func TestEnvResolveStrictDefault(t *testing.T) {
+	envInstance = nil
+	if GetEnvInstance().ResolveStrictDefault(false) {
+		t.Error("expected strict to be false, got: true")
+	}
+	if !GetEnvInstance().ResolveStrictDefault(true) {
+		t.Error("expected strict to be true, got: false")
+	}
+	os.Setenv("RDCT_STRICT", "false")
+	defer os.Unsetenv("RDCT_STRICT")
+	envInstance = nil
+	if GetEnvInstance().ResolveStrictDefault(true) {
+		t.Error("expected strict to be false, got: true")
+	}
+}
+
+func TestEnvResolveVarTypes(t *testing.T) {
+	os.Setenv("RDCT_TYPE_test_list", "list")
+	defer os.Unsetenv("RDCT_TYPE_test_list")
+	envInstance = nil
+	defer func() { envInstance = nil }()
+	types := GetEnvInstance().ResolveVarTypes()
+	if len(types) != 1 || types["test_list"] != "list" {
+		t.Error("expected types to be map[test_list:list], got: ", types)
+	}
+}
+
+func TestEnvResolvePreRenderHooks(t *testing.T) {
+	env := &Env{map[string]string{
+		"RDCT_PRE_RENDER_2":         "/hooks/b.sh,timeout=5s",
+		"RDCT_DEFAULT_PRE_RENDER_1": "/hooks/default.sh",
+		"RDCT_PRE_RENDER_1":         "/hooks/a.sh",
+		"RDCT_DEFAULT_PRE_RENDER_3": "/hooks/c.sh",
+		"RDCT_PRE_RENDER_5":         " ",
+		"RDCT_PRE_RENDER_MODE":      "exec",
+		"RDCT_PRE_RENDER_DIR":       "/hooks.d",
+	}}
+	hooks, err := env.ResolvePreRenderHooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PreRenderHook{
+		{Path: "/hooks/a.sh"},
+		{Path: "/hooks/b.sh", Timeout: 5 * time.Second},
+		{Path: "/hooks/c.sh"},
+	}
+	if len(hooks) != len(expected) {
+		t.Fatal("Expected ", len(expected), " hooks, got: ", hooks)
+	}
+	for i, hook := range hooks {
+		if hook != expected[i] {
+			t.Errorf("Expected hook %d to be %+v, got: %+v", i+1, expected[i], hook)
+		}
+	}
+	if dir := env.ResolvePreRenderDir(); dir != "/hooks.d" {
+		t.Error("Expected pre-render dir to be \"/hooks.d\", got: ", dir)
+	}
+	env.env["RDCT_PRE_RENDER_4"] = "/hooks/d.sh,retries=many"
+	if _, err = env.ResolvePreRenderHooks(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestEnvResolvePostRenderHooks(t *testing.T) {
+	env := &Env{map[string]string{
+		"RDCT_DEFAULT_POST_RENDER_1": "nginx -t",
+		"RDCT_POST_RENDER_2":         "/migrate.sh up,timeout=1m",
+	}}
+	hooks, err := env.ResolvePostRenderHooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 2 || strings.Join(hooks[0].Args, " ") != "nginx -t" || hooks[1].Timeout != time.Minute {
+		t.Errorf("Expected nginx and migrate hooks, got: %+v", hooks)
+	}
+	// blank hooks are skipped
+	env.env["RDCT_POST_RENDER_3"] = "  "
+	if hooks, err = env.ResolvePostRenderHooks(); err != nil || len(hooks) != 2 {
+		t.Errorf("Expected 2 hooks, got: %+v %v", hooks, err)
+	}
+	env.env["RDCT_POST_RENDER_4"] = "sh -c 'true"
+	if _, err = env.ResolvePostRenderHooks(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestEnvResolvePreRenderFilter(t *testing.T) {
+	env := &Env{map[string]string{"RDCT_DEFAULT_PRE_RENDER_DENY": "RDCT_*, PATH"}}
+	if allow, err := env.ResolvePreRenderAllowDefault([]string{"db_*"}); err != nil || len(allow) != 1 || allow[0] != "db_*" {
+		t.Error("Expected allow to be [db_*], got: ", allow, err)
+	}
+	if deny, err := env.ResolvePreRenderDeny(); err != nil || len(deny) != 2 || deny[0] != "RDCT_*" || deny[1] != "PATH" {
+		t.Error("Expected deny to be [RDCT_* PATH], got: ", deny, err)
+	}
+	env.env["RDCT_PRE_RENDER_ALLOW"] = "es_*"
+	if allow, err := env.ResolvePreRenderAllowDefault([]string{"db_*"}); err != nil || len(allow) != 1 || allow[0] != "es_*" {
+		t.Error("Expected allow to be [es_*], got: ", allow, err)
+	}
+	// malformed globs
+	if _, err := env.ResolvePreRenderDenyDefault([]string{"db_[*"}); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	env.env["RDCT_PRE_RENDER_DENY"] = "db_[*"
+	if _, err := env.ResolvePreRenderDeny(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	env.env["RDCT_PRE_RENDER_ALLOW"] = "es_\\"
+	if _, err := env.ResolvePreRenderAllow(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestEnvResolvePreRenderReport(t *testing.T) {
+	env := &Env{map[string]string{"RDCT_DEFAULT_PRE_RENDER_MASK": "PASS, DSN"}}
+	if env.ResolvePreRenderReportValues() {
+		t.Error("Expected report values to be false, got: true")
+	}
+	if mask := env.ResolvePreRenderMask(); len(mask) != 2 || mask[0] != "PASS" || mask[1] != "DSN" {
+		t.Error("Expected mask to be [PASS DSN], got: ", mask)
+	}
+	env.env["RDCT_PRE_RENDER_REPORT_VALUES"] = "true"
+	env.env["RDCT_PRE_RENDER_MASK"] = "TOKEN"
+	if !env.ResolvePreRenderReportValues() {
+		t.Error("Expected report values to be true, got: false")
+	}
+	if mask := env.ResolvePreRenderMaskDefault([]string{"KEY"}); len(mask) != 1 || mask[0] != "TOKEN" {
+		t.Error("Expected mask to be [TOKEN], got: ", mask)
+	}
+}
+
+func TestEnvResolveFileVarNames(t *testing.T) {
+	env := &Env{map[string]string{"RDCT_DEFAULT_FILE_VARS": "true"}}
+	if !env.ResolveFileVarsEnabled() || env.ResolveFileVarNames() != nil {
+		t.Error("Expected all file vars to be enabled, got: ", env.ResolveFileVarNames())
+	}
+	if names := env.ResolveFileVarNamesDefault([]string{"API_KEY"}); len(names) != 1 || names[0] != "API_KEY" {
+		t.Error("Expected names to be [API_KEY], got: ", names)
+	}
+	env.env["RDCT_FILE_VARS"] = "DB_PASSWORD, API_KEY"
+	names := env.ResolveFileVarNames()
+	if !env.ResolveFileVarsEnabled() || len(names) != 2 || names[0] != "DB_PASSWORD" || names[1] != "API_KEY" {
+		t.Error("Expected names to be [DB_PASSWORD API_KEY], got: ", names)
+	}
+	env.env["RDCT_FILE_VARS"] = "false"
+	if env.ResolveFileVarsEnabledDefault(true) || env.ResolveFileVarNamesDefault([]string{"API_KEY"}) != nil {
+		t.Error("Expected file vars to be disabled")
+	}
+}
+
+func TestEnvEnviron(t *testing.T) {
+	env := &Env{map[string]string{"B": "x=y", "A": ""}}
+	environ := env.Environ()
+	if len(environ) != 2 || environ[0] != "A=" || environ[1] != "B=x=y" {
+		t.Error("Expected [A= B=x=y], got: ", environ)
+	}
+}
@@ -0,0 +1,69 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// env var name suffix for vars whose value is read from a file i.e. the
+// docker secrets convention of DB_PASSWORD_FILE=/run/secrets/db_password
+const envKeyFileSuffix = "_FILE"
+
+// FileVarMaxSize is the maximum size in bytes of a file read for a `_FILE`
+// env var
+var FileVarMaxSize int64 = 1 << 20
+
+// ResolveFileVars sets every env var FOO to the contents of the file named by
+// FOO_FILE with trailing newlines trimmed. When `vars` are given, only those
+// env vars are resolved. Reserved redact env vars are never resolved and it is
+// an error for both FOO and FOO_FILE to be set.
+func (e *Env) ResolveFileVars(vars ...string) error {
+	var names []string
+	for _, varName := range vars {
+		if _, ok := e.env[varName+envKeyFileSuffix]; ok && !strings.HasPrefix(varName, envKeyPrefix) {
+			names = append(names, varName+envKeyFileSuffix)
+		}
+	}
+	for name := range e.env {
+		if len(vars) == 0 && strings.HasSuffix(name, envKeyFileSuffix) && len(name) > len(envKeyFileSuffix) &&
+			!strings.HasPrefix(name, envKeyPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		varName := strings.TrimSuffix(name, envKeyFileSuffix)
+		if _, ok := e.env[varName]; ok {
+			return errors.New("both " + varName + " and " + name + " are set")
+		}
+		val, err := readFileVar(e.env[name])
+		if err != nil {
+			return errors.New(fmt.Sprint(name, ": ", err))
+		}
+		e.env[varName] = val
+	}
+	return nil
+}
+
+// readFileVar returns the contents of the file at `path` with trailing
+// newlines trimmed or an error if the file exceeds `FileVarMaxSize`
+func readFileVar(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(f, FileVarMaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > FileVarMaxSize {
+		return "", errors.New(fmt.Sprintf("%s exceeds max size of %d bytes", path, FileVarMaxSize))
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
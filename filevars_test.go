@@ -0,0 +1,69 @@
+package redact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveFileVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact-filevars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	if err = ioutil.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := &Env{map[string]string{
+		"DB_PASSWORD_FILE": secret,
+		"RDCT_TPL_FILE":    secret,
+		"_FILE":            secret,
+	}}
+	if err = env.ResolveFileVars(); err != nil {
+		t.Fatal(err)
+	}
+	if val := env.Find("DB_PASSWORD"); val != "s3cret" {
+		t.Error("Expected DB_PASSWORD to be \"s3cret\", got: ", val)
+	}
+	if _, err = env.FindE("RDCT_TPL"); err == nil {
+		t.Error("Expected RDCT_TPL to not be set")
+	}
+	// only listed vars are resolved
+	env = &Env{map[string]string{
+		"DB_PASSWORD_FILE": secret,
+		"LOG_FILE":         filepath.Join(dir, "missing"),
+		"RDCT_TPL_FILE":    secret,
+	}}
+	if err = env.ResolveFileVars("DB_PASSWORD", "API_KEY", "RDCT_TPL"); err != nil {
+		t.Fatal(err)
+	}
+	if val := env.Find("DB_PASSWORD"); val != "s3cret" {
+		t.Error("Expected DB_PASSWORD to be \"s3cret\", got: ", val)
+	}
+	for _, name := range []string{"LOG", "API_KEY", "RDCT_TPL"} {
+		if _, err = env.FindE(name); err == nil {
+			t.Errorf("Expected %s to not be set", name)
+		}
+	}
+	// both var and file var set
+	env = &Env{map[string]string{"DB_PASSWORD": "a", "DB_PASSWORD_FILE": secret}}
+	if err = env.ResolveFileVars(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	// unreadable file
+	env = &Env{map[string]string{"DB_PASSWORD_FILE": filepath.Join(dir, "missing")}}
+	if err = env.ResolveFileVars(); err == nil || !strings.HasPrefix(err.Error(), "DB_PASSWORD_FILE: ") {
+		t.Error("Expected err to be DB_PASSWORD_FILE error, got: ", err)
+	}
+	// file too large
+	defer func(max int64) { FileVarMaxSize = max }(FileVarMaxSize)
+	FileVarMaxSize = 3
+	env = &Env{map[string]string{"DB_PASSWORD_FILE": secret}}
+	if err = env.ResolveFileVars(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
@@ -0,0 +1,45 @@
+package redact
+
+import (
+	"sort"
+
+	"github.com/emacski/redact/template"
+)
+
+// TplVar represents a variable referenced by a template
+type TplVar struct {
+	Name     string
+	Lines    []int // template lines referencing the variable
+	Set      bool  // whether the variable is currently set
+	Optional bool  // whether the template renders in strict mode without it
+}
+
+// LintTpl parses a template and returns every variable it references sorted
+// by name along with whether each variable is currently set
+func LintTpl(tplPath, engine string) ([]TplVar, error) {
+	vars := GetEnvInstance().ToMap()
+	eng, err := template.EngineFactory(engine)
+	if err != nil {
+		return nil, err
+	}
+	tpl := template.NewWithOptions(tplPath, vars, eng, TplOptions)
+	refs, err := tpl.Refs()
+	if err != nil {
+		return nil, err
+	}
+	var tplVars []TplVar
+	var index = make(map[string]int)
+	for _, ref := range refs {
+		i, ok := index[ref.Name]
+		if !ok {
+			i = len(tplVars)
+			index[ref.Name] = i
+			tplVars = append(tplVars, TplVar{Name: ref.Name, Optional: true})
+		}
+		tplVars[i].Lines = append(tplVars[i].Lines, ref.Line)
+		tplVars[i].Set = tplVars[i].Set || tpl.HasVar(ref)
+		tplVars[i].Optional = tplVars[i].Optional && !tpl.RequiresVar(ref)
+	}
+	sort.Slice(tplVars, func(i, j int) bool { return tplVars[i].Name < tplVars[j].Name })
+	return tplVars, nil
+}
@@ -0,0 +1,41 @@
+package redact
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLintTpl(t *testing.T) {
+	envInstance = nil
+	for path, engine := range map[string]string{"test/strict.redacted": "go", "test/strict.mustache": "mustache"} {
+		vars, err := LintTpl(path, engine)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		lastLine := 3
+		if engine == "go" {
+			lastLine = 4
+		}
+		expected := []TplVar{
+			{Name: "test_app_var", Lines: []int{1}, Set: true},
+			{Name: "test_missing_one", Lines: []int{2}, Optional: true},
+			{Name: "test_missing_two", Lines: []int{lastLine}},
+		}
+		if engine == "go" { // `with` pipeline reference
+			expected[0].Lines = []int{1, 3}
+		}
+		if !reflect.DeepEqual(vars, expected) {
+			t.Errorf("Expected %v for %s, got: %v", expected, path, vars)
+		}
+	}
+}
+
+func TestLintTplSyntaxError(t *testing.T) {
+	if _, err := LintTpl("test/invalid.redacted", "go"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	if _, err := LintTpl("test/invalid.mustache", "mustache"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
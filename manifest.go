@@ -0,0 +1,92 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Manifest represents a declarative description of everything to render. Both
+// YAML and JSON manifest files are supported.
+type Manifest struct {
+	Engine                string             `yaml:"engine"`
+	Coerce                bool               `yaml:"coerce"`
+	Types                 map[string]string  `yaml:"types"`
+	NestDelim             string             `yaml:"nestDelim"`
+	FileRoots             []string           `yaml:"fileRoots"`
+	Sources               []string           `yaml:"sources"`
+	PreRender             []string           `yaml:"preRender"`
+	PreRenderDir          string             `yaml:"preRenderDir"`
+	PreRenderMode         string             `yaml:"preRenderMode"`
+	PreRenderAllow        []string           `yaml:"preRenderAllow"`
+	PreRenderDeny         []string           `yaml:"preRenderDeny"`
+	PreRenderReportValues bool               `yaml:"preRenderReportValues"`
+	PreRenderMask         []string           `yaml:"preRenderMask"`
+	PostRender            []string           `yaml:"postRender"`
+	Templates             []ManifestTemplate `yaml:"templates"`
+}
+
+// ManifestTemplate represents a single template entry in a manifest
+type ManifestTemplate struct {
+	Template string `yaml:"template"`
+	Config   string `yaml:"config"`
+	Engine   string `yaml:"engine"`
+	Mode     string `yaml:"mode"`
+	Owner    string `yaml:"owner"`
+}
+
+// LoadManifest reads and parses the manifest file at `path`
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err = yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, errors.New(fmt.Sprint(path, ": ", err))
+	}
+	return m, nil
+}
+
+// Targets returns the manifest templates as render targets. Templates without
+// an engine use the manifest engine which may also be empty.
+func (m *Manifest) Targets() ([]RenderTarget, error) {
+	targets := make([]RenderTarget, len(m.Templates))
+	for i, tpl := range m.Templates {
+		if len(tpl.Template) == 0 || len(tpl.Config) == 0 {
+			return nil, errors.New(fmt.Sprintf("manifest template %d: template and config are required", i+1))
+		}
+		mode, err := parseFileMode(tpl.Mode)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("manifest template %d: %s", i+1, err))
+		}
+		targets[i] = RenderTarget{
+			TplPath: tpl.Template,
+			CfgPath: tpl.Config,
+			Engine:  tpl.Engine,
+			Mode:    mode,
+			Owner:   tpl.Owner,
+		}
+		if len(targets[i].Engine) == 0 {
+			targets[i].Engine = m.Engine
+		}
+	}
+	return targets, nil
+}
+
+// parseFileMode parses an octal file mode string (i.e. "0640") where an empty
+// string results in a zero mode
+func parseFileMode(s string) (os.FileMode, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, errors.New("invalid file mode: " + s)
+	}
+	return os.FileMode(mode), nil
+}
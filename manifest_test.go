@@ -0,0 +1,116 @@
+package redact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+var (
+	manifestPathYAML = "test/manifest.yaml"
+	manifestPathJSON = "test/manifest.json"
+)
+
+func TestLoadManifest(t *testing.T) {
+	m, err := LoadManifest(manifestPathYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Engine != "mustache" {
+		t.Error("Expected engine to be mustache, got: ", m.Engine)
+	}
+	if len(m.PreRender) != 1 || m.PreRender[0] != preRenderScriptPath {
+		t.Error("Expected pre-render to be [test/pre-render.sh], got: ", m.PreRender)
+	}
+	if len(m.Templates) != 2 {
+		t.Fatal("Expected 2 templates, got: ", len(m.Templates))
+	}
+	m, err = LoadManifest(manifestPathJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Templates) != 1 || m.Templates[0].Config != "/path/to/config" {
+		t.Error("Unexpected json manifest templates: ", m.Templates)
+	}
+}
+
+func TestManifestTargets(t *testing.T) {
+	m, err := LoadManifest(manifestPathYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := m.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RenderTarget{
+		{TplPath: tplPathMustache, CfgPath: "/path/to/config1", Engine: "mustache", Mode: 0640, Owner: "root"},
+		{TplPath: tplPathGo, CfgPath: "/path/to/config2", Engine: "go"},
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Errorf("Expected target %d to be %v, got: %v", i+1, expected[i], targets[i])
+		}
+	}
+	m.Templates[0].Mode = "999"
+	if _, err = m.Targets(); err == nil {
+		t.Error("Expected err to be error for invalid mode, got: nil")
+	}
+}
+
+func TestEnvResolveTargetsDefault(t *testing.T) {
+	os.Setenv("RDCT_CFG_PATH_2", "/path/to/override/config2")
+	os.Setenv("RDCT_CFG_MODE_2", "0640")
+	defer os.Unsetenv("RDCT_CFG_PATH_2")
+	defer os.Unsetenv("RDCT_CFG_MODE_2")
+	envInstance = nil
+	defer func() { envInstance = nil }()
+	defaults := []RenderTarget{
+		{TplPath: "/path/to/template1", CfgPath: "/path/to/config1", Mode: 0600},
+		{TplPath: "/path/to/template2", CfgPath: "/path/to/config2", Engine: "mustache"},
+	}
+	targets, err := GetEnvInstance().ResolveTargetsDefault(defaults, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RenderTarget{
+		{TplPath: "/path/to/template1", CfgPath: "/path/to/config1", Engine: "go", Mode: 0600},
+		{TplPath: "/path/to/template2", CfgPath: "/path/to/override/config2", Engine: "mustache", Mode: 0640},
+	}
+	if len(targets) != len(expected) {
+		t.Fatal("Expected 2 targets, got: ", len(targets))
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Errorf("Expected target %d to be %v, got: %v", i+1, expected[i], targets[i])
+		}
+	}
+}
+
+func TestRenderCfgFilesPerms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfgPath := filepath.Join(dir, "go.conf")
+	targets := []RenderTarget{
+		{TplPath: tplPathGo, CfgPath: cfgPath, Engine: "go", Mode: 0600, Owner: strconv.Itoa(os.Getuid())},
+	}
+	if err = RenderCfgFiles(targets); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Error("Expected mode to be 0600, got: ", info.Mode().Perm())
+	}
+	if uid := info.Sys().(*syscall.Stat_t).Uid; int(uid) != os.Getuid() {
+		t.Error("Expected owner uid to be ", os.Getuid(), ", got: ", uid)
+	}
+}
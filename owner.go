@@ -0,0 +1,20 @@
+package redact
+
+import (
+	"github.com/opencontainers/runc/libcontainer/user"
+)
+
+// lookupUser resolves a user spec in the form <user or uid> or
+// <user or uid>:<group or gid> against the system passwd and group files
+func lookupUser(spec string) (*user.ExecUser, error) {
+	defaults := &user.ExecUser{Uid: 0, Gid: 0, Home: "/"}
+	passwdPath, err := user.GetPasswdPath()
+	if err != nil {
+		return nil, err
+	}
+	groupPath, err := user.GetGroupPath()
+	if err != nil {
+		return nil, err
+	}
+	return user.GetExecUserPath(spec, defaults, passwdPath, groupPath)
+}
@@ -0,0 +1,302 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/emacski/redact/template"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// passthrough config output formats
+const (
+	FormatProperties = "properties"
+	FormatINI        = "ini"
+	FormatYAML       = "yaml"
+	FormatJSON       = "json"
+	FormatTOML       = "toml"
+	FormatEnv        = "env"
+)
+
+// passthrough config key cases
+const (
+	KeyCaseLower = "lower"
+	KeyCaseUpper = "upper"
+	KeyCaseKeep  = "keep"
+)
+
+// DefaultKeyReplacements are the env var name to config key replacements
+// (old, new pairs) used by many popular images i.e. KAFKA_LOG_RETENTION_HOURS
+// to log.retention.hours
+var DefaultKeyReplacements = []string{"___", "-", "__", "_", "_", "."}
+
+// Passthrough represents the rules for translating env vars directly to a
+// config file without a template
+type Passthrough struct {
+	Prefix       string   // only env vars with prefix are included (prefix is stripped)
+	Case         string   // config key case (lower, upper or keep)
+	Replacements []string // old, new pairs replaced in a single pass in order of precedence
+	Format       string   // output format
+}
+
+// Keys returns the config keys and values translated from `env`
+func (p *Passthrough) Keys(env map[string]string) (map[string]string, error) {
+	if len(p.Prefix) == 0 {
+		return nil, errors.New("passthrough env var prefix not specified")
+	}
+	if len(p.Replacements)%2 != 0 {
+		return nil, errors.New("passthrough key replacements must be old, new pairs")
+	}
+	replacer := strings.NewReplacer(p.Replacements...)
+	keys := make(map[string]string)
+	for name, val := range env {
+		if !strings.HasPrefix(name, p.Prefix) || name == p.Prefix {
+			continue
+		}
+		key := strings.TrimPrefix(name, p.Prefix)
+		switch p.Case {
+		case KeyCaseLower, "":
+			key = strings.ToLower(key)
+		case KeyCaseUpper:
+			key = strings.ToUpper(key)
+		case KeyCaseKeep:
+		default:
+			return nil, errors.New("invalid passthrough key case: " + p.Case)
+		}
+		keys[replacer.Replace(key)] = val
+	}
+	return keys, nil
+}
+
+// RenderPassthroughStdOut renders a passthrough config to stdout
+func RenderPassthroughStdOut(p *Passthrough) error {
+	return RenderPassthrough(p, os.Stdout)
+}
+
+// RenderPassthroughFile renders a passthrough config to a file where the
+// config file is replaced atomically
+func RenderPassthroughFile(p *Passthrough, cfgPath string, mode os.FileMode, owner string) error {
+	var buf bytes.Buffer
+	if err := RenderPassthrough(p, &buf); err != nil {
+		return err
+	}
+	return writeCfgAtomic(cfgPath, mode, owner, writeBytes(buf.Bytes()))
+}
+
+// RenderPassthrough renders a passthrough config from env vars to any
+// io.Writer in the passthrough format
+func RenderPassthrough(p *Passthrough, w io.Writer) error {
+	keys, err := p.Keys(GetEnvInstance().ToMap())
+	if err != nil {
+		return err
+	}
+	switch p.Format {
+	case FormatProperties, "":
+		return writeProperties(keys, w)
+	case FormatEnv:
+		return writeEnvFile(keys, w)
+	case FormatINI:
+		return writeINI(keys, w)
+	}
+	// structured formats nest keys on "." and use typed values
+	tree, err := nestKeys(keys)
+	if err != nil {
+		return err
+	}
+	switch p.Format {
+	case FormatJSON:
+		b, err := json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	case FormatYAML:
+		b, err := yaml.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case FormatTOML:
+		return writeTOML(tree, w)
+	default:
+		return errors.New("invalid passthrough format: " + p.Format)
+	}
+}
+
+// sortedKeys returns the keys of `m` in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeProperties writes keys as java properties
+func writeProperties(keys map[string]string, w io.Writer) error {
+	keyEscaper := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "=", `\=`, ":", `\:`, " ", `\ `)
+	valEscaper := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+	for _, k := range sortedKeys(keys) {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", keyEscaper.Replace(k), valEscaper.Replace(keys[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEnvFile writes keys as a shell compatible env file with double quoted
+// values where characters invalid in shell variable names are replaced with
+// "_" i.e. log.dirs is written as log_dirs
+func writeEnvFile(keys map[string]string, w io.Writer) error {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	names := make(map[string]string)
+	for _, k := range sortedKeys(keys) {
+		name := envFileName(k)
+		if conflict, ok := names[name]; ok {
+			return errors.New("conflicting env file keys: " + conflict + " and " + k)
+		}
+		names[name] = k
+	}
+	for _, name := range sortedKeys(names) {
+		if _, err := fmt.Fprintf(w, "%s=\"%s\"\n", name, escaper.Replace(keys[names[name]])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envFileName returns `k` as a valid shell variable name
+func envFileName(k string) string {
+	name := []rune(k)
+	for i, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		return "_" + string(name)
+	}
+	return string(name)
+}
+
+// writeINI writes keys as INI where the first "." separated segment of a key
+// is its section and keys without a "." are written before any section
+func writeINI(keys map[string]string, w io.Writer) error {
+	var buf bytes.Buffer
+	sections := make(map[string]map[string]string)
+	for _, k := range sortedKeys(keys) {
+		pair := strings.SplitN(k, ".", 2)
+		if len(pair) == 1 {
+			fmt.Fprintf(&buf, "%s = %s\n", k, iniValue(keys[k]))
+			continue
+		}
+		if sections[pair[0]] == nil {
+			sections[pair[0]] = make(map[string]string)
+		}
+		sections[pair[0]][pair[1]] = keys[k]
+	}
+	var names []string
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if buf.Len() != 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "[%s]\n", name)
+		for _, k := range sortedKeys(sections[name]) {
+			fmt.Fprintf(&buf, "%s = %s\n", k, iniValue(sections[name][k]))
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// iniValue returns `val` as is unless written raw it would span lines, be read
+// as a comment or quoted value or lose surrounding whitespace, in which case
+// it's double quoted with backslash escapes
+func iniValue(val string) string {
+	if !strings.ContainsAny(val, "\n\r") && !strings.HasPrefix(val, `"`) && !strings.HasPrefix(val, ";") &&
+		!strings.HasPrefix(val, "#") && strings.TrimSpace(val) == val {
+		return val
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + escaper.Replace(val) + `"`
+}
+
+// configTree is a nested map of config keys which is distinct from map values
+// decoded from JSON env var values
+type configTree map[string]interface{}
+
+// nestKeys returns keys as nested config trees split on "." with values
+// coerced to typed values by convention
+func nestKeys(keys map[string]string) (configTree, error) {
+	tree := make(configTree)
+	for _, k := range sortedKeys(keys) {
+		node := tree
+		path := strings.Split(k, ".")
+		for i, segment := range path {
+			if i == len(path)-1 {
+				if _, ok := node[segment]; ok {
+					return nil, errors.New("conflicting config key: " + k)
+				}
+				node[segment] = template.Coerce(keys[k])
+				break
+			}
+			child, ok := node[segment]
+			if !ok {
+				child = make(configTree)
+				node[segment] = child
+			}
+			if node, ok = child.(configTree); !ok {
+				return nil, errors.New("conflicting config key: " + k)
+			}
+		}
+	}
+	return tree, nil
+}
+
+// writeTOML writes a config tree as TOML
+func writeTOML(tree configTree, w io.Writer) error {
+	return toml.NewEncoder(w).Encode(tomlData(tree))
+}
+
+// tomlData returns `v` with config trees as plain maps and JSON numbers as
+// int64 or float64 values so they are encoded as TOML tables and numbers
+func tomlData(v interface{}) interface{} {
+	switch val := v.(type) {
+	case configTree:
+		return tomlData(map[string]interface{}(val))
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, elem := range val {
+			m[k] = tomlData(elem)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, elem := range val {
+			list[i] = tomlData(elem)
+		}
+		return list
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
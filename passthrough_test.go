@@ -0,0 +1,114 @@
+package redact
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPassthroughKeys(t *testing.T) {
+	p := &Passthrough{Prefix: "KAFKA_", Replacements: DefaultKeyReplacements}
+	keys, err := p.Keys(map[string]string{
+		"KAFKA_LOG_RETENTION_HOURS":      "168",
+		"KAFKA_ADVERTISED___LISTENERS":   "PLAINTEXT://kafka:9092",
+		"KAFKA_CONFLUENT_SUPPORT__OPTIN": "false",
+		"KAFKA_":                         "ignored",
+		"ZOOKEEPER_CONNECT":              "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"log.retention.hours":     "168",
+		"advertised-listeners":    "PLAINTEXT://kafka:9092",
+		"confluent.support_optin": "false",
+	}
+	if len(keys) != len(expected) {
+		t.Error("Expected ", len(expected), " keys, got: ", keys)
+	}
+	for k, v := range expected {
+		if keys[k] != v {
+			t.Errorf("Expected %s to be %q, got: %q", k, v, keys[k])
+		}
+	}
+	p.Case = "invalid"
+	if _, err = p.Keys(map[string]string{"KAFKA_A": "a"}); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestRenderPassthrough(t *testing.T) {
+	vars := map[string]string{
+		"TESTPT_SERVER_PORT":  "8080",
+		"TESTPT_SERVER_HOST":  "0.0.0.0",
+		"TESTPT_DEBUG":        "true",
+		"TESTPT_LOG_PATTERNS": `["a","b"]`,
+	}
+	for k, v := range vars {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	envInstance = nil
+	defer func() { envInstance = nil }()
+	expected := map[string]string{
+		FormatProperties: "debug=true\nlog.patterns=[\"a\",\"b\"]\nserver.host=0.0.0.0\nserver.port=8080\n",
+		FormatEnv:        "debug=\"true\"\nlog_patterns=\"[\\\"a\\\",\\\"b\\\"]\"\nserver_host=\"0.0.0.0\"\nserver_port=\"8080\"\n",
+		FormatINI:        "debug = true\n\n[log]\npatterns = [\"a\",\"b\"]\n\n[server]\nhost = 0.0.0.0\nport = 8080\n",
+		FormatJSON: `{
+  "debug": true,
+  "log": {
+    "patterns": [
+      "a",
+      "b"
+    ]
+  },
+  "server": {
+    "host": "0.0.0.0",
+    "port": 8080
+  }
+}
+`,
+		FormatYAML: "debug: true\nlog:\n  patterns:\n  - a\n  - b\nserver:\n  host: 0.0.0.0\n  port: 8080\n",
+		FormatTOML: "debug = true\n\n[log]\n  patterns = [\"a\", \"b\"]\n\n[server]\n  host = \"0.0.0.0\"\n  port = 8080\n",
+	}
+	for format, out := range expected {
+		var rendered = new(bytes.Buffer)
+		p := &Passthrough{Prefix: "TESTPT_", Replacements: DefaultKeyReplacements, Format: format}
+		if err := RenderPassthrough(p, rendered); err != nil {
+			t.Error(format, ": ", err)
+			continue
+		}
+		if rendered.String() != out {
+			t.Errorf("Expected %s to be %q, got: %q", format, out, rendered.String())
+		}
+	}
+	// ini values that would break out of their key are quoted
+	os.Setenv("TESTPT_MOTD", "hello\n[admin]\npassword = x")
+	envInstance = nil
+	var rendered = new(bytes.Buffer)
+	p := &Passthrough{Prefix: "TESTPT_", Replacements: DefaultKeyReplacements, Format: FormatINI}
+	if err := RenderPassthrough(p, rendered); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rendered.String(), "motd = \"hello\\n[admin]\\npassword = x\"\n") {
+		t.Errorf("Expected quoted motd value, got: %q", rendered.String())
+	}
+	os.Unsetenv("TESTPT_MOTD")
+	// env file names that only differ by invalid characters conflict
+	os.Setenv("TESTPT_SERVER__HOST", "conflict")
+	envInstance = nil
+	p = &Passthrough{Prefix: "TESTPT_", Replacements: DefaultKeyReplacements, Format: FormatEnv}
+	if err := RenderPassthrough(p, new(bytes.Buffer)); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	os.Unsetenv("TESTPT_SERVER__HOST")
+	// conflicting keys can't be nested
+	os.Setenv("TESTPT_SERVER", "conflict")
+	defer os.Unsetenv("TESTPT_SERVER")
+	envInstance = nil
+	p = &Passthrough{Prefix: "TESTPT_", Replacements: DefaultKeyReplacements, Format: FormatJSON}
+	if err := RenderPassthrough(p, new(bytes.Buffer)); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
@@ -0,0 +1,366 @@
+package redact
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/emacski/redact/template"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// PatchSet represents a value to set at a key path in a structured config
+type PatchSet struct {
+	Path  []string
+	Value string
+}
+
+// ParsePatchSet parses a patch set from a string in the form KEY.PATH=VALUE
+func ParsePatchSet(s string) (PatchSet, error) {
+	pair := strings.SplitN(s, "=", 2)
+	if len(pair) != 2 || len(pair[0]) == 0 {
+		return PatchSet{}, errors.New("invalid patch set (expected KEY.PATH=VALUE): " + s)
+	}
+	return PatchSet{Path: strings.Split(pair[0], "."), Value: pair[1]}, nil
+}
+
+// ResolvePatchMapping returns the patch sets for a YAML or JSON mapping file
+// of env var names to dot separated key paths. Only env vars that are set
+// result in a patch set.
+func (e *Env) ResolvePatchMapping(mappingPath string) ([]PatchSet, error) {
+	data, err := ioutil.ReadFile(mappingPath)
+	if err != nil {
+		return nil, err
+	}
+	var mapping map[string]string
+	if err = yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, errors.New(fmt.Sprint(mappingPath, ": ", err))
+	}
+	var names []string
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sets []PatchSet
+	for _, name := range names {
+		if val, ok := e.env[name]; ok {
+			sets = append(sets, PatchSet{Path: strings.Split(mapping[name], "."), Value: val})
+		}
+	}
+	return sets, nil
+}
+
+// PatchCfgFile applies patch sets to an existing YAML, JSON, TOML or INI config
+// file and atomically writes the result back. When `format` is empty, it is
+// detected from the config file extension. Values are coerced to typed values
+// by convention for all formats except INI. Comments are only preserved for
+// INI.
+func PatchCfgFile(cfgPath, format string, sets []PatchSet) error {
+	if len(format) == 0 {
+		format = patchFormat(cfgPath)
+	}
+	data, err := ioutil.ReadFile(cfgPath)
+	if err != nil {
+		return err
+	}
+	var patched []byte
+	switch format {
+	case FormatYAML:
+		patched, err = patchYAML(data, sets)
+	case FormatJSON:
+		patched, err = patchJSON(data, sets)
+	case FormatTOML:
+		patched, err = patchTOML(data, sets)
+	case FormatINI:
+		patched, err = patchINI(data, sets)
+	default:
+		return errors.New("invalid patch format: " + format)
+	}
+	if err != nil {
+		return errors.New(fmt.Sprint(cfgPath, ": ", err))
+	}
+	return writeCfgAtomic(cfgPath, 0, "", writeBytes(patched))
+}
+
+// patchFormat returns the config format for the config file extension
+func patchFormat(cfgPath string) string {
+	switch strings.ToLower(filepath.Ext(cfgPath)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	case ".ini", ".cfg", ".conf":
+		return FormatINI
+	}
+	return ""
+}
+
+// patchYAML applies patch sets to YAML data preserving key order. Comments
+// are not preserved.
+func patchYAML(data []byte, sets []PatchSet) ([]byte, error) {
+	doc, err := patchYAMLDoc(data, sets)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// patchJSON applies patch sets to JSON data preserving key order
+func patchJSON(data []byte, sets []PatchSet) ([]byte, error) {
+	// JSON is valid YAML so decode with order preserving YAML map slices
+	doc, err := patchYAMLDoc(data, sets)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = writeOrderedJSON(&buf, doc, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// patchYAMLDoc decodes YAML data to map slices and applies patch sets. Data
+// with multiple YAML documents is an error since only one could be written.
+func patchYAMLDoc(data []byte, sets []PatchSet) (yaml.MapSlice, error) {
+	var doc yaml.MapSlice
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var next interface{}
+	if err := dec.Decode(&next); err == nil {
+		return nil, errors.New("multiple YAML documents are not supported")
+	} else if err != io.EOF {
+		return nil, err
+	}
+	for _, set := range sets {
+		var err error
+		if doc, err = setMapSlice(doc, set.Path, template.Coerce(set.Value)); err != nil {
+			return nil, errors.New(fmt.Sprint(strings.Join(set.Path, "."), ": ", err))
+		}
+	}
+	return doc, nil
+}
+
+// setMapSlice sets `val` at `path` in `m` creating maps as required
+func setMapSlice(m yaml.MapSlice, path []string, val interface{}) (yaml.MapSlice, error) {
+	for i := range m {
+		if fmt.Sprint(m[i].Key) != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			m[i].Value = val
+			return m, nil
+		}
+		child, ok := m[i].Value.(yaml.MapSlice)
+		if !ok && m[i].Value != nil {
+			return nil, errors.New("key " + path[0] + " is not a map")
+		}
+		child, err := setMapSlice(child, path[1:], val)
+		if err != nil {
+			return nil, err
+		}
+		m[i].Value = child
+		return m, nil
+	}
+	if len(path) == 1 {
+		return append(m, yaml.MapItem{Key: path[0], Value: val}), nil
+	}
+	child, err := setMapSlice(nil, path[1:], val)
+	if err != nil {
+		return nil, err
+	}
+	return append(m, yaml.MapItem{Key: path[0], Value: child}), nil
+}
+
+// writeOrderedJSON writes YAML decoded values as indented JSON preserving the
+// key order of map slices
+func writeOrderedJSON(buf *bytes.Buffer, v interface{}, indent string) error {
+	switch val := v.(type) {
+	case yaml.MapSlice:
+		if len(val) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i, item := range val {
+			key, _ := json.Marshal(fmt.Sprint(item.Key))
+			buf.WriteString(indent + "  " + string(key) + ": ")
+			if err := writeOrderedJSON(buf, item.Value, indent+"  "); err != nil {
+				return err
+			}
+			if i < len(val)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		if len(val) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, elem := range val {
+			buf.WriteString(indent + "  ")
+			if err := writeOrderedJSON(buf, elem, indent+"  "); err != nil {
+				return err
+			}
+			if i < len(val)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	default:
+		b, err := json.MarshalIndent(val, indent, "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// patchTOML applies patch sets to TOML data
+func patchTOML(data []byte, sets []PatchSet) ([]byte, error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	for _, set := range sets {
+		if err := setMap(doc, set.Path, template.Coerce(set.Value)); err != nil {
+			return nil, errors.New(fmt.Sprint(strings.Join(set.Path, "."), ": ", err))
+		}
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(tomlData(doc)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// setMap sets `val` at `path` in `m` creating maps as required
+func setMap(m map[string]interface{}, path []string, val interface{}) error {
+	if len(path) == 1 {
+		m[path[0]] = val
+		return nil
+	}
+	child, ok := m[path[0]]
+	if !ok {
+		child = make(map[string]interface{})
+		m[path[0]] = child
+	}
+	nested, ok := child.(map[string]interface{})
+	if !ok {
+		return errors.New("key " + path[0] + " is not a table")
+	}
+	return setMap(nested, path[1:], val)
+}
+
+// patchINI applies patch sets to INI data by updating key lines in place so
+// comments and formatting are preserved. Key paths are either `key` for keys
+// before any section or `section.key`.
+func patchINI(data []byte, sets []PatchSet) ([]byte, error) {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for _, set := range sets {
+		var section, key string
+		switch len(set.Path) {
+		case 1:
+			key = set.Path[0]
+		case 2:
+			section, key = set.Path[0], set.Path[1]
+		default:
+			return nil, errors.New("ini key paths must be [section.]key: " + strings.Join(set.Path, "."))
+		}
+		lines = setINI(lines, section, key, set.Value)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// setINI sets the key in section replacing an existing key line, appending
+// the key to the end of the section or appending a new section
+func setINI(lines []string, section, key, val string) []string {
+	var current string
+	var sectionEnd = -1 // index after the last line of the target section
+	if len(section) == 0 {
+		sectionEnd = 0
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			current = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if len(trimmed) != 0 && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, ";") {
+			sectionEnd = i + 1
+		} else if sectionEnd == -1 {
+			sectionEnd = i
+		}
+		sep := strings.IndexAny(line, "=:")
+		if sep == -1 || strings.TrimSpace(line[:sep]) != key {
+			continue
+		}
+		// keep the existing key and separator formatting
+		prefix := line[:sep+1]
+		if sep+1 < len(line) && line[sep+1] == ' ' {
+			prefix += " "
+		}
+		lines[i] = prefix + iniValue(val)
+		return lines
+	}
+	kv := key + " = " + iniValue(val)
+	if sectionEnd == -1 {
+		// section doesn't exist or is empty so find its header or append it
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") && strings.TrimSpace(trimmed[1:len(trimmed)-1]) == section {
+				sectionEnd = i + 1
+			}
+		}
+		if sectionEnd == -1 {
+			if len(lines) != 0 && len(strings.TrimSpace(lines[len(lines)-1])) != 0 {
+				lines = append(lines, "")
+			}
+			return append(lines, "["+section+"]", kv)
+		}
+	}
+	lines = append(lines, "")
+	copy(lines[sectionEnd+1:], lines[sectionEnd:])
+	lines[sectionEnd] = kv
+	return lines
+}
+
+// hasEmptyString reports whether any string in `s` is empty
+func hasEmptyString(s []string) bool {
+	for _, v := range s {
+		if len(v) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package redact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePatchSets(t *testing.T) {
+	env := &Env{map[string]string{
+		"RDCT_SET__server__port": "8080",
+		"RDCT_SET__debug":        "true",
+		"RDCT_SET__bad____key":   "ignored",
+		"RDCT_TPL_PATH":          "ignored",
+	}}
+	sets := env.ResolvePatchSets()
+	if len(sets) != 2 {
+		t.Fatal("Expected 2 patch sets, got: ", sets)
+	}
+	if len(sets[0].Path) != 1 || sets[0].Path[0] != "debug" || sets[0].Value != "true" {
+		t.Error("Expected debug=true, got: ", sets[0])
+	}
+	if len(sets[1].Path) != 2 || sets[1].Path[0] != "server" || sets[1].Path[1] != "port" || sets[1].Value != "8080" {
+		t.Error("Expected server.port=8080, got: ", sets[1])
+	}
+}
+
+func TestParsePatchSet(t *testing.T) {
+	set, err := ParsePatchSet("server.tls.enabled=a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Path) != 3 || set.Path[2] != "enabled" || set.Value != "a=b" {
+		t.Error("Expected server.tls.enabled=a=b, got: ", set)
+	}
+	if _, err = ParsePatchSet("server.port"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestPatchCfgFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact-patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sets := []PatchSet{
+		{Path: []string{"server", "port"}, Value: "8080"},
+		{Path: []string{"log", "level"}, Value: "debug"},
+	}
+	cases := []struct {
+		name, data, expected string
+	}{
+		{
+			"config.yaml",
+			"server:\n  host: 0.0.0.0\n  port: 80\nname: app\n",
+			"server:\n  host: 0.0.0.0\n  port: 8080\nname: app\nlog:\n  level: debug\n",
+		},
+		{
+			"config.json",
+			`{"server": {"host": "0.0.0.0", "port": 80}, "name": "app"}`,
+			"{\n  \"server\": {\n    \"host\": \"0.0.0.0\",\n    \"port\": 8080\n  },\n  \"name\": \"app\",\n  \"log\": {\n    \"level\": \"debug\"\n  }\n}\n",
+		},
+		{
+			"config.toml",
+			"name = \"app\"\n\n[server]\nhost = \"0.0.0.0\"\nport = 80\n",
+			"name = \"app\"\n\n[log]\n  level = \"debug\"\n\n[server]\n  host = \"0.0.0.0\"\n  port = 8080\n",
+		},
+		{
+			"config.ini",
+			"name = app\n\n[server]\n; listen address\nhost = 0.0.0.0\nport=80\n\n[other]\nkey = val\n",
+			"name = app\n\n[server]\n; listen address\nhost = 0.0.0.0\nport=8080\n\n[other]\nkey = val\n\n[log]\nlevel = debug\n",
+		},
+		{
+			// a lone bracket isn't a section header
+			"bracket.ini",
+			"name = app\n[\n",
+			"name = app\n[\n\n[server]\nport = 8080\n\n[log]\nlevel = debug\n",
+		},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name)
+		if err = ioutil.WriteFile(path, []byte(c.data), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err = PatchCfgFile(path, "", sets); err != nil {
+			t.Error(c.name, ": ", err)
+			continue
+		}
+		patched, _ := ioutil.ReadFile(path)
+		if string(patched) != c.expected {
+			t.Errorf("Expected %s to be:\n%s\ngot:\n%s", c.name, c.expected, patched)
+		}
+		// existing file mode is preserved
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+			t.Errorf("Expected %s mode to be 0640, got: %#o", c.name, info.Mode().Perm())
+		}
+	}
+	// keys that aren't maps can't be patched
+	path := filepath.Join(dir, "config.yaml")
+	if err = PatchCfgFile(path, "", []PatchSet{{Path: []string{"name", "first"}, Value: "a"}}); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	// only one YAML document can be patched
+	path = filepath.Join(dir, "multi.yaml")
+	if err = ioutil.WriteFile(path, []byte("name: one\n---\nname: two\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err = PatchCfgFile(path, "", sets); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	if err = PatchCfgFile(path, "xml", sets); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
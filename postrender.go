@@ -0,0 +1,168 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// env vars exposing rendered paths to post-render hooks
+const (
+	postRenderCfgPathVar  = "RDCT_RENDERED_CFG_PATH"
+	postRenderTplPathVar  = "RDCT_RENDERED_TPL_PATH"
+	postRenderCfgPathsVar = "RDCT_RENDERED_CFG_PATHS"
+)
+
+// PostRenderHook represents a command run after rendering and before the
+// entrypoint command is executed i.e. to validate the rendered config
+type PostRenderHook struct {
+	Args    []string
+	Timeout time.Duration // no timeout if 0
+}
+
+// ParsePostRenderHook parses a post-render hook from a string in the form
+// COMMAND [ARGS...][,timeout=DURATION] where the command and args are split
+// into words the same as a shell would without any expansion, so single and
+// double quotes and backslashes can be used for args with whitespace or commas
+// i.e. "sh -c 'nginx -t -c \"$RDCT_RENDERED_CFG_PATH\"',timeout=10s"
+func ParsePostRenderHook(s string) (PostRenderHook, error) {
+	args, opts, hasOpts, err := splitWords(s, ',')
+	if err != nil {
+		return PostRenderHook{}, errors.New(fmt.Sprint("invalid post-render hook: ", s, ": ", err))
+	}
+	hook := PostRenderHook{Args: args}
+	if len(hook.Args) == 0 {
+		return hook, errors.New("invalid post-render hook: " + s + ": empty command")
+	}
+	if !hasOpts {
+		return hook, nil
+	}
+	for _, opt := range strings.Split(opts, ",") {
+		pair := strings.SplitN(opt, "=", 2)
+		var err error
+		switch {
+		case pair[0] == "timeout" && len(pair) == 2:
+			hook.Timeout, err = time.ParseDuration(pair[1])
+		default:
+			err = errors.New("unknown option " + opt)
+		}
+		if err != nil {
+			return hook, errors.New(fmt.Sprint("invalid post-render hook: ", s, ": ", err))
+		}
+	}
+	return hook, nil
+}
+
+// splitWords splits `s` into words on unquoted whitespace up to the first
+// unquoted `sep` returning the words and whether `sep` was found along with
+// the remainder after it. Quotes and backslashes are handled the same as sh.
+func splitWords(s string, sep byte) (words []string, rest string, found bool, err error) {
+	var word bytes.Buffer
+	var inWord bool
+	var quote byte
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else if c == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`", s[i+1]) >= 0 {
+				i++
+				word.WriteByte(s[i])
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, "", false, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == sep:
+			flush()
+			return words, s[i+1:], true, nil
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, "", false, errors.New("unterminated quote")
+	}
+	flush()
+	return words, "", false, nil
+}
+
+// PostRenderContext represents the execution context for a post-render hook
+type PostRenderContext struct {
+	Env    []string // hook env in the form KEY=VALUE or the process env if nil
+	StdOut string
+	StdErr string
+}
+
+// Exec runs the post-render hook where the rendered paths of `targets` are
+// exposed to it as env vars. A failed hook's error includes its stderr.
+func (p *PostRenderContext) Exec(hook PostRenderHook, targets []RenderTarget) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(hook.Args[0], hook.Args[1:]...)
+	cmd.Env = append(p.environ(), RenderedEnv(targets)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := runTimeout(cmd, hook.Timeout)
+	p.StdOut, p.StdErr = stdout.String(), stderr.String()
+	if err != nil {
+		return errors.New(fmt.Sprint(strings.Join(hook.Args, " "), ": ", p.StdErr, err))
+	}
+	return nil
+}
+
+// environ returns the hook env
+func (p *PostRenderContext) environ() []string {
+	if p.Env == nil {
+		return os.Environ()
+	}
+	return p.Env
+}
+
+// RenderedEnv returns the env vars exposing the rendered paths of `targets` to
+// post-render hooks: RDCT_RENDERED_CFG_PATH_N and RDCT_RENDERED_TPL_PATH_N for
+// every target numbered from 1, RDCT_RENDERED_CFG_PATH for the first target
+// and RDCT_RENDERED_CFG_PATHS with every config path separated by ":"
+func RenderedEnv(targets []RenderTarget) []string {
+	var env []string
+	var cfgPaths []string
+	for i, t := range targets {
+		env = append(env,
+			indexedKey(postRenderCfgPathVar, i+1)+"="+t.CfgPath,
+			indexedKey(postRenderTplPathVar, i+1)+"="+t.TplPath,
+		)
+		cfgPaths = append(cfgPaths, t.CfgPath)
+	}
+	if len(targets) != 0 {
+		env = append(env, postRenderCfgPathVar+"="+targets[0].CfgPath)
+	}
+	return append(env, postRenderCfgPathsVar+"="+strings.Join(cfgPaths, string(filepath.ListSeparator)))
+}
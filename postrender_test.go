@@ -0,0 +1,93 @@
+package redact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePostRenderHook(t *testing.T) {
+	hook, err := ParsePostRenderHook("nginx -t  -c /etc/nginx/nginx.conf,timeout=10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(hook.Args, "|") != "nginx|-t|-c|/etc/nginx/nginx.conf" || hook.Timeout != 10*time.Second {
+		t.Errorf("Expected nginx hook with 10s timeout, got: %+v", hook)
+	}
+	// args are split like a shell without expansion
+	hook, err = ParsePostRenderHook(`sh -c 'nginx -t -c "$RDCT_RENDERED_CFG_PATH"' "a,b" c\ d "e\"f\g",timeout=1s`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"sh", "-c", `nginx -t -c "$RDCT_RENDERED_CFG_PATH"`, "a,b", "c d", `e"f\g`}
+	if strings.Join(hook.Args, "|") != strings.Join(expected, "|") || hook.Timeout != time.Second {
+		t.Errorf("Expected args %q with 1s timeout, got: %+v", expected, hook)
+	}
+	if hook, err = ParsePostRenderHook(`echo ''`); err != nil || len(hook.Args) != 2 || hook.Args[1] != "" {
+		t.Errorf("Expected empty arg, got: %q %v", hook.Args, err)
+	}
+	for _, s := range []string{"", " ,timeout=1s", "nginx -t,timeout=soon", "nginx -t,retries=3", "nginx -t,", `sh -c 'true`, `echo \`} {
+		if _, err = ParsePostRenderHook(s); err == nil {
+			t.Errorf("Expected err to be error for %q, got: nil", s)
+		}
+	}
+}
+
+func TestPostRenderContextExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var targets []RenderTarget
+	for _, name := range []string{"a.conf", "b.conf"} {
+		var cfgPath = filepath.Join(dir, name)
+		if err = ioutil.WriteFile(cfgPath, []byte("listen 80\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, RenderTarget{TplPath: cfgPath + ".redacted", CfgPath: cfgPath})
+	}
+	ctx := new(PostRenderContext)
+	if err = ctx.Exec(PostRenderHook{Args: []string{"test/post-render.sh", "listen"}}, targets); err != nil {
+		t.Fatal(err)
+	}
+	var expected = "config ok: " + targets[0].CfgPath + ":" + targets[1].CfgPath + "\n"
+	if ctx.StdOut != expected {
+		t.Errorf("Expected stdout %q, got: %q", expected, ctx.StdOut)
+	}
+	// failed validation includes stderr
+	err = ctx.Exec(PostRenderHook{Args: []string{"test/post-render.sh", "server_name"}}, targets)
+	if err == nil || !strings.Contains(err.Error(), "invalid config "+targets[0].CfgPath) {
+		t.Error("Expected error with hook stderr, got: ", err)
+	}
+	err = ctx.Exec(PostRenderHook{Args: []string{"sleep", "60"}, Timeout: 100 * time.Millisecond}, targets)
+	if err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestRenderedEnv(t *testing.T) {
+	env := environToMap(RenderedEnv([]RenderTarget{
+		{TplPath: "/a.conf.redacted", CfgPath: "/etc/a.conf"},
+		{TplPath: "/b.conf.redacted", CfgPath: "/etc/b.conf"},
+	}))
+	expected := map[string]string{
+		"RDCT_RENDERED_CFG_PATH":   "/etc/a.conf",
+		"RDCT_RENDERED_CFG_PATH_1": "/etc/a.conf",
+		"RDCT_RENDERED_TPL_PATH_1": "/a.conf.redacted",
+		"RDCT_RENDERED_CFG_PATH_2": "/etc/b.conf",
+		"RDCT_RENDERED_TPL_PATH_2": "/b.conf.redacted",
+		"RDCT_RENDERED_CFG_PATHS":  "/etc/a.conf:/etc/b.conf",
+	}
+	if len(env) != len(expected) {
+		t.Error("Expected ", len(expected), " vars, got: ", env)
+	}
+	for name, val := range expected {
+		if env[name] != val {
+			t.Errorf("Expected %s to be %q, got: %q", name, val, env[name])
+		}
+	}
+}
@@ -4,37 +4,420 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 const preRenderDelimeter = "RDCT_PRERENDER_ENV"
 
+// env var naming the file an exec mode pre-render script writes variables to
+// and its value, the write end of a pipe passed to the script as fd 3 so no
+// writable temp dir is required
+const (
+	preRenderOutputVar  = "RDCT_OUTPUT"
+	preRenderOutputPath = "/dev/fd/3"
+)
+
+// pre-render script modes
+const (
+	// the script is sourced by `sh` and its resulting env is captured
+	PreRenderModeSource = "source"
+	// the script is executed directly and writes variables to $RDCT_OUTPUT
+	PreRenderModeExec = "exec"
+)
+
+// PreRenderHook represents a pre-render script and how it is executed
+type PreRenderHook struct {
+	Path            string
+	Timeout         time.Duration // no timeout if 0
+	Retries         int           // attempts after the first failed attempt
+	Backoff         time.Duration // wait before the first retry doubled for every retry after
+	ContinueOnError bool          // rendering continues if every attempt fails
+}
+
+// ParsePreRenderHook parses a pre-render hook from a string in the form
+// PATH[,timeout=DURATION][,retries=N][,backoff=DURATION][,continue-on-error]
+// i.e. "/fetch-config.sh,timeout=30s,retries=3,backoff=1s"
+func ParsePreRenderHook(s string) (PreRenderHook, error) {
+	parts := strings.Split(s, ",")
+	hook := PreRenderHook{Path: parts[0]}
+	if len(hook.Path) == 0 {
+		return hook, errors.New("invalid pre-render hook: " + s + ": empty path")
+	}
+	for _, opt := range parts[1:] {
+		pair := strings.SplitN(opt, "=", 2)
+		var err error
+		switch {
+		case pair[0] == "continue-on-error" && len(pair) == 1:
+			hook.ContinueOnError = true
+		case pair[0] == "timeout" && len(pair) == 2:
+			hook.Timeout, err = time.ParseDuration(pair[1])
+		case pair[0] == "retries" && len(pair) == 2:
+			hook.Retries, err = strconv.Atoi(pair[1])
+			if err == nil && hook.Retries < 0 {
+				err = errors.New("negative retries")
+			}
+		case pair[0] == "backoff" && len(pair) == 2:
+			hook.Backoff, err = time.ParseDuration(pair[1])
+		default:
+			err = errors.New("unknown option " + opt)
+		}
+		if err != nil {
+			return hook, errors.New(fmt.Sprint("invalid pre-render hook: ", s, ": ", err))
+		}
+	}
+	return hook, nil
+}
+
+// PreRenderHookDir returns a hook with the options of `dir` for every script
+// in the directory at `dir.Path` (i.e. /docker-entrypoint.d) sorted by name.
+// Scripts are `*.sh` files in source mode and executable files in exec mode.
+// Hidden files and directories are skipped.
+func PreRenderHookDir(dir PreRenderHook, mode string) ([]PreRenderHook, error) {
+	names, err := readDirNames(dir.Path)
+	if err != nil {
+		return nil, err
+	}
+	var hooks []PreRenderHook
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		var path = filepath.Join(dir.Path, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		switch mode {
+		case "", PreRenderModeSource:
+			if filepath.Ext(name) != ".sh" {
+				continue
+			}
+		case PreRenderModeExec:
+			if info.Mode()&0111 == 0 {
+				continue
+			}
+		default:
+			return nil, errors.New("invalid pre-render mode: " + mode)
+		}
+		hook := dir
+		hook.Path = path
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// PreRenderAttempt represents the outcome of a single pre-render hook attempt
+type PreRenderAttempt struct {
+	Context *PreRenderContext // script output of the attempt
+	Err     error
+	Retry   bool          // whether the hook is retried after failing
+	Backoff time.Duration // wait before the retry
+}
+
+// Run executes the hook in `mode` with the env `env` returning the variables
+// of the script. Failed attempts are retried with backoff and `attempted`, if
+// not nil, is called after every attempt. Nil variables and no error are
+// returned if every attempt failed and the hook continues on error.
+func (h PreRenderHook) Run(mode string, env []string, attempted func(PreRenderAttempt)) (map[string]string, error) {
+	var backoff = h.Backoff
+	for attempt := 0; ; attempt++ {
+		ctx := &PreRenderContext{Mode: mode, Timeout: h.Timeout, Env: env}
+		vars, err := ctx.Exec(h.Path)
+		var retry = err != nil && attempt < h.Retries
+		if attempted != nil {
+			attempted(PreRenderAttempt{Context: ctx, Err: err, Retry: retry, Backoff: backoff})
+		}
+		if err == nil {
+			return vars, nil
+		}
+		if !retry {
+			if h.ContinueOnError {
+				return nil, nil
+			}
+			return nil, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// env vars managed by the shell sourcing a pre-render script rather than the
+// script itself
+var preRenderShellVars = map[string]bool{"PWD": true, "OLDPWD": true, "SHLVL": true, "_": true}
+
+// DefaultSecretNameParts are the case insensitive parts of variable names
+// whose values are masked in pre-render diff reports that include values
+var DefaultSecretNameParts = []string{"PASS", "SECRET", "TOKEN", "KEY", "CREDENTIAL", "PRIVATE", "AUTH", "DSN", "URL"}
+
+// PreRenderFilter controls which variables a pre-render script may set, change
+// or remove by name glob (i.e. "DB_*"). Denied names take precedence and, if
+// any allowed names are given, only matching variables may be set.
+type PreRenderFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+// Allowed reports whether a pre-render script may set the variable `name`
+// where malformed globs never match (see `ResolvePreRenderAllow`)
+func (f PreRenderFilter) Allowed(name string) bool {
+	for _, pattern := range f.Deny {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range f.Allow {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// PreRenderDiff represents the changes the variables of a pre-render script
+// make to the env
+type PreRenderDiff struct {
+	Added   map[string]string
+	Changed map[string]string
+	Removed []string // sorted names
+	Denied  []string // sorted names of changes not allowed by the filter
+}
+
+// DiffPreRenderVars returns the changes `vars` returned by a pre-render script
+// make to the variables `env` it ran with where changes not allowed by
+// `filter` are denied. In source mode `vars` is the full env of the script so
+// variables it unset are removed, except those with names a shell can't keep.
+func DiffPreRenderVars(env, vars map[string]string, mode string, filter PreRenderFilter) PreRenderDiff {
+	var sourced = mode != PreRenderModeExec
+	diff := PreRenderDiff{Added: make(map[string]string), Changed: make(map[string]string)}
+	for name, val := range vars {
+		if sourced && preRenderShellVars[name] {
+			continue
+		}
+		old, ok := env[name]
+		if ok && old == val {
+			continue
+		}
+		if !filter.Allowed(name) {
+			diff.Denied = append(diff.Denied, name)
+		} else if ok {
+			diff.Changed[name] = val
+		} else {
+			diff.Added[name] = val
+		}
+	}
+	if sourced {
+		for name := range env {
+			if _, ok := vars[name]; ok || preRenderShellVars[name] || !isShellName(name) {
+				continue
+			}
+			if !filter.Allowed(name) {
+				diff.Denied = append(diff.Denied, name)
+				continue
+			}
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Denied)
+	return diff
+}
+
+// Apply applies the allowed changes to `env`
+func (d PreRenderDiff) Apply(env *Env) {
+	env.Merge(d.Added)
+	env.Merge(d.Changed)
+	for _, name := range d.Removed {
+		env.Unset(name)
+	}
+}
+
+// Report returns a sorted line per change in the form "added NAME", "changed
+// NAME", "removed NAME" or "denied NAME". With `values`, added and changed
+// lines are in the form "added NAME=VALUE" where the values of variables with
+// names containing any of the case insensitive parts `mask` (i.e. PASSWORD)
+// are masked.
+func (d PreRenderDiff) Report(values bool, mask []string) []string {
+	var lines []string
+	for name, val := range d.Added {
+		lines = append(lines, "added "+reportVar(name, val, values, mask))
+	}
+	for name, val := range d.Changed {
+		lines = append(lines, "changed "+reportVar(name, val, values, mask))
+	}
+	for _, name := range d.Removed {
+		lines = append(lines, "removed "+name)
+	}
+	for _, name := range d.Denied {
+		lines = append(lines, "denied "+name)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// reportVar returns `name` or, with `values`, NAME=VALUE where `val` is masked
+// if `name` contains any of the parts `mask`
+func reportVar(name, val string, values bool, mask []string) string {
+	if !values {
+		return name
+	}
+	var upper = strings.ToUpper(name)
+	for _, part := range mask {
+		if strings.Contains(upper, strings.ToUpper(part)) {
+			return name + "=********"
+		}
+	}
+	return name + "=" + val
+}
+
+// isShellName reports whether `name` is a valid shell variable name
+func isShellName(name string) bool {
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
 // PreRenderContext represents the execution context for a pre-render script
 type PreRenderContext struct {
-	StdOut string
-	StdErr string
-	stdout bytes.Buffer // raw stdout from script execution
-	stderr bytes.Buffer // raw stderr from script execution
+	Mode    string        // PreRenderModeSource (default) or PreRenderModeExec
+	Timeout time.Duration // no timeout if 0
+	Env     []string      // script env in the form KEY=VALUE or the process env if nil
+	StdOut  string
+	StdErr  string
+	stdout  bytes.Buffer // raw stdout from script execution
+	stderr  bytes.Buffer // raw stderr from script execution
 }
 
 // Exec executes the pre-render script within the context
 func (p *PreRenderContext) Exec(scriptPath string) (map[string]string, error) {
 	p.reset() // reset std stream states before each run
-	subcmd := fmt.Sprintf("source %s && echo '%s' && env", scriptPath, preRenderDelimeter)
+	switch p.Mode {
+	case "", PreRenderModeSource:
+		return p.source(scriptPath)
+	case PreRenderModeExec:
+		return p.exec(scriptPath)
+	}
+	return nil, errors.New("invalid pre-render mode: " + p.Mode)
+}
+
+// source sources the pre-render script with `sh` returning the resulting env.
+// The env is captured NUL delimited so exported values may contain newlines.
+func (p *PreRenderContext) source(scriptPath string) (map[string]string, error) {
+	// "." only searches PATH for paths without a slash
+	if !strings.Contains(scriptPath, "/") {
+		scriptPath = "./" + scriptPath
+	}
+	subcmd := fmt.Sprintf(". %s && echo '%s' && env -0", shellQuote(scriptPath), preRenderDelimeter)
 	cmd := exec.Command("sh", "-c", subcmd)
+	cmd.Env = p.environ()
 	cmd.Stdout, cmd.Stderr = &p.stdout, &p.stderr
-	if err := cmd.Run(); err != nil {
+	if err := p.run(cmd); err != nil {
 		p.StdOut, p.StdErr = p.stdout.String(), p.stderr.String()
 		return nil, errors.New(fmt.Sprint(p.stderr.String(), err))
 	}
-	stdoutSplit := strings.Split(p.stdout.String(), preRenderDelimeter+"\n")
-	p.StdOut, p.StdErr = stdoutSplit[0], p.stderr.String()
-	envlist := strings.Split(stdoutSplit[1], "\n")
+	// the env follows the last delimiter as the script output may also echo it
+	stdout := p.stdout.String()
+	i := strings.LastIndex(stdout, preRenderDelimeter+"\n")
+	if i < 0 {
+		return nil, errors.New("pre-render env not found in output")
+	}
+	p.StdOut, p.StdErr = stdout[:i], p.stderr.String()
+	envlist := strings.Split(stdout[i+len(preRenderDelimeter)+1:], "\x00")
 	return environToMap(envlist[:len(envlist)-1]), nil
 }
 
+// exec executes the pre-render script directly, so no shell is required, and
+// returns the variables it writes to the file named by $RDCT_OUTPUT (fd 3) as
+// either KEY=VALUE lines (.env format) or a JSON object
+func (p *PreRenderContext) exec(scriptPath string) (map[string]string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// the output is read while the script runs so it can't fill the pipe
+	var output = make(chan []byte, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		output <- data
+	}()
+	cmd := exec.Command(scriptPath)
+	cmd.Env = append(p.environ(), preRenderOutputVar+"="+preRenderOutputPath)
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Stdout, cmd.Stderr = &p.stdout, &p.stderr
+	err = p.run(cmd)
+	w.Close()
+	p.StdOut, p.StdErr = p.stdout.String(), p.stderr.String()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(p.stderr.String(), err))
+	}
+	data := <-output
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return parseJSONVars(data)
+	}
+	return parseDotEnv(bytes.NewReader(data))
+}
+
+// run runs `cmd` with the context timeout
+func (p *PreRenderContext) run(cmd *exec.Cmd) error {
+	return runTimeout(cmd, p.Timeout)
+}
+
+// environ returns the script env
+func (p *PreRenderContext) environ() []string {
+	if p.Env == nil {
+		return os.Environ()
+	}
+	return p.Env
+}
+
 func (p *PreRenderContext) reset() {
 	p.StdOut, p.StdErr = "", ""
 	p.stdout, p.stderr = bytes.Buffer{}, bytes.Buffer{}
 }
+
+// shellQuote returns `s` single quoted for sh
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// runTimeout runs `cmd` where, with a timeout, the command runs in its own
+// process group so any processes it started (i.e. curl) are also killed on
+// timeout
+func runTimeout(cmd *exec.Cmd, timeout time.Duration) error {
+	if timeout <= 0 {
+		return cmd.Run()
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(timeout, func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err := cmd.Wait()
+	if !timer.Stop() {
+		return errors.New(fmt.Sprint("timed out after ", timeout))
+	}
+	return err
+}
@@ -1,6 +1,13 @@
 package redact
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
 
 var preRenderScriptPath = "test/pre-render.sh"
 
@@ -16,4 +23,281 @@ func TestPreRenderContextExec(t *testing.T) {
 	if envs["test_app_var"] != "override" {
 		t.Error("Expected \"test_app_var\" value to be \"override\", got ", envs["test_app_var"])
 	}
+	// values containing "=", empty values and multi-line values
+	expected := map[string]string{
+		"pre_render_opts":  "-Dfoo=bar -Dbaz=qux==",
+		"pre_render_empty": "",
+		"pre_render_pem":   "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----",
+	}
+	for name, val := range expected {
+		if actual, ok := envs[name]; !ok || actual != val {
+			t.Errorf("Expected %s to be %q, got: %q", name, val, actual)
+		}
+	}
+	if envs["MIIB"] != "" || envs["-----END CERTIFICATE-----"] != "" {
+		t.Error("Expected multi-line value lines not to be vars, got: ", envs)
+	}
+	if ctx.StdOut != "begin pre-render script\nmid pre-render script\nend pre-render script\n" {
+		t.Errorf("Expected script output, got: %q", ctx.StdOut)
+	}
+}
+
+func TestPreRenderContextExecPathSpaces(t *testing.T) {
+	ctx := new(PreRenderContext)
+	envs, err := ctx.Exec("test/pre render/source.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envs["pre_render"] != "spaces" {
+		t.Error("Expected \"pre_render\" value to be \"spaces\", got ", envs["pre_render"])
+	}
+}
+
+func TestPreRenderContextExecMode(t *testing.T) {
+	// no writable temp dir is required
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", "/nonexistent")
+	ctx := &PreRenderContext{Mode: PreRenderModeExec}
+	envs, err := ctx.Exec("test/pre render/exec.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only variables written to $RDCT_OUTPUT are returned
+	expected := map[string]string{"pre_render": "exec", "pre_render_opts": "-Dfoo=bar"}
+	if len(envs) != len(expected) {
+		t.Error("Expected ", len(expected), " vars, got: ", envs)
+	}
+	for name, val := range expected {
+		if envs[name] != val {
+			t.Errorf("Expected %s to be %q, got: %q", name, val, envs[name])
+		}
+	}
+	if ctx.StdOut != "exec pre-render script\n" {
+		t.Errorf("Expected script output, got: %q", ctx.StdOut)
+	}
+	// JSON output
+	if envs, err = ctx.Exec("test/pre render/exec-json.sh"); err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]string{"pre_render": "json", "pre_render_pem": "a\nb", "pre_render_port": "8080"}
+	for name, val := range expected {
+		if envs[name] != val {
+			t.Errorf("Expected %s to be %q, got: %q", name, val, envs[name])
+		}
+	}
+	if _, err = ctx.Exec("test/missing.sh"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	ctx.Mode = "invalid"
+	if _, err = ctx.Exec("test/pre render/exec.sh"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestPreRenderContextExecTimeout(t *testing.T) {
+	ctx := &PreRenderContext{Mode: PreRenderModeExec, Timeout: 100 * time.Millisecond}
+	var start = time.Now()
+	// the sleep started by the script is killed with it
+	if _, err := ctx.Exec("test/pre-render-hang.sh"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Error("Expected timeout after 100ms, took: ", elapsed)
+	}
+}
+
+func TestPreRenderContextExecEnv(t *testing.T) {
+	ctx := &PreRenderContext{Env: []string{"PATH=/usr/bin:/bin", "pre_render_input=-Dfoo=bar"}}
+	envs, err := ctx.Exec("test/pre render/source.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envs["pre_render_input"] != "-Dfoo=bar" {
+		t.Error("Expected \"pre_render_input\" value to be \"-Dfoo=bar\", got ", envs["pre_render_input"])
+	}
+	if _, ok := envs["test_app_var"]; ok {
+		t.Error("Expected process env not to be used, got: ", envs)
+	}
+}
+
+func TestParsePreRenderHook(t *testing.T) {
+	hook, err := ParsePreRenderHook("/hooks/fetch.sh,timeout=30s,retries=3,backoff=1s,continue-on-error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := PreRenderHook{
+		Path:            "/hooks/fetch.sh",
+		Timeout:         30 * time.Second,
+		Retries:         3,
+		Backoff:         time.Second,
+		ContinueOnError: true,
+	}
+	if hook != expected {
+		t.Errorf("Expected %+v, got: %+v", expected, hook)
+	}
+	if hook, err = ParsePreRenderHook("/hooks/fetch.sh"); err != nil || hook != (PreRenderHook{Path: "/hooks/fetch.sh"}) {
+		t.Errorf("Expected path only hook, got: %+v %v", hook, err)
+	}
+	for _, s := range []string{"", ",timeout=1s", "/a.sh,timeout=soon", "/a.sh,retries=-1", "/a.sh,unknown", "/a.sh,continue-on-error=true"} {
+		if _, err = ParsePreRenderHook(s); err == nil {
+			t.Errorf("Expected err to be error for %q, got: nil", s)
+		}
+	}
+}
+
+func TestPreRenderHookDir(t *testing.T) {
+	cases := map[string][]string{
+		// only *.sh files are sourced
+		PreRenderModeSource: {"test/pre render/exec-json.sh", "test/pre render/exec.sh", "test/pre render/source.sh"},
+		// only executable files are executed
+		PreRenderModeExec: {"test/pre render/exec-json.sh", "test/pre render/exec.sh"},
+	}
+	for mode, expected := range cases {
+		hooks, err := PreRenderHookDir(PreRenderHook{Path: "test/pre render", Timeout: time.Second}, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hooks) != len(expected) {
+			t.Fatal("Expected ", len(expected), " hooks in ", mode, " mode, got: ", hooks)
+		}
+		for i, hook := range hooks {
+			if hook.Path != expected[i] || hook.Timeout != time.Second {
+				t.Errorf("Expected hook %s with 1s timeout, got: %+v", expected[i], hook)
+			}
+		}
+	}
+	if _, err := PreRenderHookDir(PreRenderHook{Path: "test/missing"}, PreRenderModeSource); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	if _, err := PreRenderHookDir(PreRenderHook{Path: "test/pre render"}, "invalid"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestPreRenderHookRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact-prerender")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the script fails until its third attempt
+	script := filepath.Join(dir, "flaky.sh")
+	data := `n=$(cat "$COUNT" 2>/dev/null || echo 0); n=$((n + 1)); echo $n > "$COUNT"; export attempts=$n; [ $n -ge 3 ]`
+	if err = ioutil.WriteFile(script, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"PATH=" + os.Getenv("PATH"), "COUNT=" + filepath.Join(dir, "count")}
+	var retries []time.Duration
+	hook := PreRenderHook{Path: script, Retries: 2, Backoff: 10 * time.Millisecond}
+	vars, err := hook.Run(PreRenderModeSource, env, func(attempt PreRenderAttempt) {
+		if attempt.Retry {
+			retries = append(retries, attempt.Backoff)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["attempts"] != "3" {
+		t.Error("Expected 3 attempts, got: ", vars["attempts"])
+	}
+	if len(retries) != 2 || retries[0] != 10*time.Millisecond || retries[1] != 20*time.Millisecond {
+		t.Error("Expected retries after 10ms and 20ms, got: ", retries)
+	}
+	// every attempt fails
+	os.Remove(filepath.Join(dir, "count"))
+	hook.Retries = 1
+	if _, err = hook.Run(PreRenderModeSource, env, nil); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	os.Remove(filepath.Join(dir, "count"))
+	hook.ContinueOnError = true
+	if vars, err = hook.Run(PreRenderModeSource, env, nil); err != nil || vars != nil {
+		t.Errorf("Expected no vars and no error, got: %v %v", vars, err)
+	}
+}
+
+func TestDiffPreRenderVars(t *testing.T) {
+	env := map[string]string{
+		"PATH":        "/bin",
+		"PWD":         "/",
+		"db_host":     "localhost",
+		"db_password": "old",
+		"old_var":     "x",
+		"es.hosts":    "es",
+		"RDCT_STRICT": "true",
+	}
+	// the full env of a sourced script where es.hosts was dropped by the shell
+	vars := map[string]string{
+		"PATH":        "/bin",
+		"PWD":         "/tmp",
+		"SHLVL":       "1",
+		"db_host":     "db",
+		"db_password": "new",
+		"new_var":     "y",
+		"api_token":   "t",
+		"DB_DSN":      "postgres://u:p@db/app",
+		"RDCT_STRICT": "false",
+	}
+	diff := DiffPreRenderVars(env, vars, PreRenderModeSource, PreRenderFilter{Deny: []string{"RDCT_*"}})
+	// only names are reported by default
+	expected := []string{
+		"added DB_DSN",
+		"added api_token",
+		"added new_var",
+		"changed db_host",
+		"changed db_password",
+		"denied RDCT_STRICT",
+		"removed old_var",
+	}
+	report := diff.Report(false, DefaultSecretNameParts)
+	if strings.Join(report, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected report %q, got: %q", expected, report)
+	}
+	expected = []string{
+		"added DB_DSN=********",
+		"added api_token=********",
+		"added new_var=y",
+		"changed db_host=db",
+		"changed db_password=********",
+		"denied RDCT_STRICT",
+		"removed old_var",
+	}
+	if report = diff.Report(true, DefaultSecretNameParts); strings.Join(report, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected report %q, got: %q", expected, report)
+	}
+	// custom mask parts are case insensitive
+	expected[0], expected[1], expected[3] = "added DB_DSN=postgres://u:p@db/app", "added api_token=t", "changed db_host=********"
+	if report = diff.Report(true, []string{"Host", "password"}); strings.Join(report, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected report %q, got: %q", expected, report)
+	}
+	e := &Env{env}
+	diff.Apply(e)
+	if e.Find("db_password") != "new" || e.Find("new_var") != "y" || e.Find("RDCT_STRICT") != "true" || e.Find("es.hosts") != "es" {
+		t.Error("Expected allowed changes to be applied, got: ", e.ToMap())
+	}
+	if _, err := e.FindE("old_var"); err == nil {
+		t.Error("Expected old_var to be removed")
+	}
+	// exec mode vars are only the script's output so nothing is removed
+	diff = DiffPreRenderVars(map[string]string{"a": "1", "b": "2"}, map[string]string{"b": "3"}, PreRenderModeExec, PreRenderFilter{})
+	if report = diff.Report(true, nil); strings.Join(report, "|") != "changed b=3" {
+		t.Error("Expected only b to change, got: ", report)
+	}
+}
+
+func TestPreRenderFilter(t *testing.T) {
+	filter := PreRenderFilter{Allow: []string{"db_*", "es_hosts"}, Deny: []string{"db_admin_*"}}
+	for name, allowed := range map[string]bool{
+		"db_host":           true,
+		"es_hosts":          true,
+		"db_admin_password": false,
+		"es_cluster":        false,
+	} {
+		if filter.Allowed(name) != allowed {
+			t.Errorf("Expected %s allowed to be %t", name, allowed)
+		}
+	}
+	if !(PreRenderFilter{}).Allowed("anything") {
+		t.Error("Expected every var to be allowed without a filter")
+	}
 }
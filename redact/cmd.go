@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/emacski/libgosu"
 	"github.com/emacski/redact"
@@ -35,35 +40,154 @@ var globalQuiet bool
 // render flags
 var (
 	renderOutPath        string
-	renderScript         string
+	renderScripts        []string
+	renderScriptDir      string
+	renderScriptMode     string
+	renderScriptAllow    []string
+	renderScriptDeny     []string
+	renderScriptValues   bool
+	renderScriptMask     []string
 	renderEngine         string
 	renderDefaultTplPath string
 	renderDefaultCfgPath string
+	renderTargets        []string
+	renderManifestPath   string
+	renderSuffixes       []string
+	renderCfgMode        string
+	renderCfgOwner       string
+	renderStrict         bool
+	renderCoerce         bool
+	renderNestDelim      string
+	renderFileVars       bool
+	renderFileVarNames   []string
+	renderSources        []string
+	renderFileRoots      []string
+	renderEnvPrefix      string
+	renderFormat         string
+	renderKeyCase        string
+	renderKeyReplace     []string
 )
 
+// exec flags
+var execSupervise bool
+
+// entrypoint flags
+var (
+	entrypointOwnerUserspec bool
+	entrypointPostRender    []string
+	entrypointWatch         bool
+	entrypointWatchSignal   string
+	entrypointWatchRestart  bool
+	entrypointWatchDebounce time.Duration
+)
+
+// lint flags
+var lintStrict bool
+
+// patch flags
+var (
+	patchSets        []string
+	patchMappingPath string
+	patchCfgFormat   string
+)
+
+// loaded render manifest if any
+var manifest *redact.Manifest
+
+// loaded variable sources if any
+var varSources []redact.Source
+
 func init() {
 	rootCmd.SetHelpTemplate(help)
 	rootCmd.SetUsageTemplate(usageTpl("[OPTIONS] COMMAND"))
 	rootCmd.PersistentFlags().BoolVarP(&globalQuiet, "quiet", "q", false, "supress command output")
 
-	renderCmd.SetUsageTemplate(usageTpl("[OPTIONS] [TEMPLATE_PATH]"))
+	renderCmd.SetUsageTemplate(usageTpl("[OPTIONS] [TEMPLATE_PATH | TEMPLATE_DIR]"))
 	renderCmd.Flags().StringVarP(&renderOutPath, "out", "o", "", "file path to render to")
-	renderCmd.Flags().StringVarP(&renderScript, "pre-render", "p", "", "EXPERIMENTAL pre-render script path")
+	renderCmd.Flags().StringArrayVarP(&renderScripts, "pre-render", "p", nil, "EXPERIMENTAL pre-render script PATH[,timeout=DURATION][,retries=N][,backoff=DURATION][,continue-on-error] (repeatable)")
+	renderCmd.Flags().StringVar(&renderScriptDir, "pre-render-dir", "", "EXPERIMENTAL dir of pre-render scripts run in name order with the same options as --pre-render")
+	renderCmd.Flags().StringVar(&renderScriptMode, "pre-render-mode", "", "pre-render script mode (source, exec) (default source)")
+	renderCmd.Flags().StringArrayVar(&renderScriptAllow, "pre-render-allow", nil, "var name glob pre-render scripts may set, all if not set (repeatable)")
+	renderCmd.Flags().StringArrayVar(&renderScriptDeny, "pre-render-deny", nil, "var name glob pre-render scripts may not set (repeatable)")
+	renderCmd.Flags().BoolVar(&renderScriptValues, "pre-render-report-values", false, "include values of variables set by pre-render scripts in reports")
+	renderCmd.Flags().StringArrayVar(&renderScriptMask, "pre-render-mask", nil, "var name part whose values are masked in pre-render reports (repeatable, default PASS, SECRET, TOKEN, KEY, CREDENTIAL, PRIVATE, AUTH, DSN, URL)")
 	renderCmd.Flags().StringVarP(&renderEngine, "default-tpl-engine", "e", "go", "default template engine (go, mustache)")
 	renderCmd.Flags().StringVarP(&renderDefaultTplPath, "default-tpl-path", "t", "", "default template path")
 	renderCmd.Flags().StringVarP(&renderDefaultCfgPath, "default-cfg-path", "c", "", "default config path")
+	renderCmd.Flags().StringVarP(&renderManifestPath, "manifest", "m", "", "render manifest path")
+	renderCmd.Flags().StringVar(&renderCfgMode, "cfg-mode", "", "rendered config file mode (i.e. 0640)")
+	renderCmd.Flags().StringVar(&renderCfgOwner, "cfg-owner", "", "rendered config file owner (<user or uid>[:<group or gid>])")
+	renderCmd.Flags().BoolVar(&renderStrict, "strict", false, "fail rendering when template variables are missing")
+	renderCmd.Flags().BoolVar(&renderCoerce, "coerce", false, "coerce template variables to typed values by convention")
+	renderCmd.Flags().StringVar(&renderNestDelim, "nest-delim", "", "variable name delimiter for nested variables (i.e. __)")
+	renderCmd.Flags().StringArrayVar(&renderSources, "source", nil, "variable source TYPE[:PATH] (env, dotenv, file, dir, stdin, vault, consul) in ascending precedence (repeatable)")
+	renderCmd.Flags().StringArrayVar(&renderFileRoots, "file-root", nil, "dir go template file functions may access (repeatable)")
+	renderCmd.Flags().BoolVar(&renderFileVars, "file-vars", false, "set FOO from FOO_FILE for every env var ending in _FILE, WARNING: includes unrelated vars (i.e. LOG_FILE) which can abort startup, prefer --file-var")
+	renderCmd.Flags().StringArrayVar(&renderFileVarNames, "file-var", nil, "set FOO to the contents of the file named by the FOO_FILE env var (repeatable)")
+	renderCmd.Flags().StringVar(&renderEnvPrefix, "env-prefix", "", "render env vars with prefix directly to config without a template")
+	renderCmd.Flags().StringVar(&renderFormat, "format", redact.FormatProperties, "env prefix config format (properties, ini, yaml, json, toml, env)")
+	renderCmd.Flags().StringVar(&renderKeyCase, "key-case", redact.KeyCaseLower, "env prefix config key case (lower, upper, keep)")
+	renderCmd.Flags().StringArrayVar(&renderKeyReplace, "key-replace", nil, "env prefix config key OLD=NEW replacement (repeatable, default ___=- __=_ _=.)")
+	renderCmd.Flags().StringSliceVar(&renderSuffixes, "suffix", redact.DefaultTplSuffixes, "template file suffixes when rendering a template directory")
 	rootCmd.AddCommand(renderCmd)
 
 	execCmd.SetUsageTemplate(usageTpl("[OPTIONS] -- USERSPEC COMMAND [ARGS...]"))
+	execCmd.Flags().BoolVar(&execSupervise, "supervise", false, "run the command as a child process forwarding signals and reaping zombies instead of replacing redact with it")
 	rootCmd.AddCommand(execCmd)
 
 	entrypointCmd.SetUsageTemplate(usageTpl("[OPTIONS] -- USERSPEC COMMAND [ARGS...]"))
-	entrypointCmd.Flags().StringVarP(&renderScript, "pre-render", "p", "", "EXPERIMENTAL pre-render script path")
+	entrypointCmd.Flags().StringArrayVarP(&renderScripts, "pre-render", "p", nil, "EXPERIMENTAL pre-render script PATH[,timeout=DURATION][,retries=N][,backoff=DURATION][,continue-on-error] (repeatable)")
+	entrypointCmd.Flags().StringVar(&renderScriptDir, "pre-render-dir", "", "EXPERIMENTAL dir of pre-render scripts run in name order with the same options as --pre-render")
+	entrypointCmd.Flags().StringVar(&renderScriptMode, "pre-render-mode", "", "pre-render script mode (source, exec) (default source)")
+	entrypointCmd.Flags().StringArrayVar(&renderScriptAllow, "pre-render-allow", nil, "var name glob pre-render scripts may set, all if not set (repeatable)")
+	entrypointCmd.Flags().StringArrayVar(&renderScriptDeny, "pre-render-deny", nil, "var name glob pre-render scripts may not set (repeatable)")
+	entrypointCmd.Flags().BoolVar(&renderScriptValues, "pre-render-report-values", false, "include values of variables set by pre-render scripts in reports")
+	entrypointCmd.Flags().StringArrayVar(&renderScriptMask, "pre-render-mask", nil, "var name part whose values are masked in pre-render reports (repeatable, default PASS, SECRET, TOKEN, KEY, CREDENTIAL, PRIVATE, AUTH, DSN, URL)")
 	entrypointCmd.Flags().StringVarP(&renderEngine, "default-tpl-engine", "e", "go", "default template engine (go, mustache)")
 	entrypointCmd.Flags().StringVarP(&renderDefaultTplPath, "default-tpl-path", "t", "", "default template path")
 	entrypointCmd.Flags().StringVarP(&renderDefaultCfgPath, "default-cfg-path", "c", "", "default config path")
+	entrypointCmd.Flags().StringArrayVarP(&renderTargets, "render", "r", nil, "additional TEMPLATE_PATH:CONFIG_PATH to render (repeatable)")
+	entrypointCmd.Flags().StringVarP(&renderManifestPath, "manifest", "m", "", "render manifest path")
+	entrypointCmd.Flags().StringVar(&renderCfgMode, "cfg-mode", "", "rendered config file mode (i.e. 0640)")
+	entrypointCmd.Flags().StringVar(&renderCfgOwner, "cfg-owner", "", "rendered config file owner (<user or uid>[:<group or gid>])")
+	entrypointCmd.Flags().BoolVar(&renderStrict, "strict", false, "fail rendering when template variables are missing")
+	entrypointCmd.Flags().BoolVar(&renderCoerce, "coerce", false, "coerce template variables to typed values by convention")
+	entrypointCmd.Flags().StringVar(&renderNestDelim, "nest-delim", "", "variable name delimiter for nested variables (i.e. __)")
+	entrypointCmd.Flags().StringArrayVar(&renderSources, "source", nil, "variable source TYPE[:PATH] (env, dotenv, file, dir, stdin, vault, consul) in ascending precedence (repeatable)")
+	entrypointCmd.Flags().StringArrayVar(&renderFileRoots, "file-root", nil, "dir go template file functions may access (repeatable)")
+	entrypointCmd.Flags().BoolVar(&renderFileVars, "file-vars", false, "set FOO from FOO_FILE for every env var ending in _FILE, WARNING: includes unrelated vars (i.e. LOG_FILE) which can abort startup, prefer --file-var")
+	entrypointCmd.Flags().StringArrayVar(&renderFileVarNames, "file-var", nil, "set FOO to the contents of the file named by the FOO_FILE env var (repeatable)")
+	entrypointCmd.Flags().StringArrayVar(&entrypointPostRender, "post-render", nil, "command run against the rendered config before it replaces the config file and the command is executed i.e. to validate it \"COMMAND [ARGS...][,timeout=DURATION]\" (repeatable)")
+	entrypointCmd.Flags().BoolVar(&entrypointOwnerUserspec, "cfg-owner-userspec", false, "default rendered config file owner to USERSPEC")
+	entrypointCmd.Flags().BoolVar(&execSupervise, "supervise", false, "run the command as a child process forwarding signals and reaping zombies instead of replacing redact with it")
+	entrypointCmd.Flags().BoolVar(&entrypointWatch, "watch", false, "stay resident, re-render on template or variable source file changes and signal the command")
+	entrypointCmd.Flags().StringVar(&entrypointWatchSignal, "watch-signal", "SIGHUP", "signal sent to the command after re-rendering")
+	entrypointCmd.Flags().BoolVar(&entrypointWatchRestart, "watch-restart", false, "restart the command after re-rendering instead of signaling it")
+	entrypointCmd.Flags().DurationVar(&entrypointWatchDebounce, "watch-debounce", time.Second, "wait for changes to settle before re-rendering")
 	rootCmd.AddCommand(entrypointCmd)
 
+	lintCmd.SetUsageTemplate(usageTpl("[OPTIONS] [TEMPLATE_PATH]"))
+	lintCmd.Flags().StringVarP(&renderEngine, "default-tpl-engine", "e", "go", "default template engine (go, mustache)")
+	lintCmd.Flags().StringVarP(&renderDefaultTplPath, "default-tpl-path", "t", "", "default template path")
+	lintCmd.Flags().BoolVar(&renderCoerce, "coerce", false, "coerce template variables to typed values by convention")
+	lintCmd.Flags().StringVar(&renderNestDelim, "nest-delim", "", "variable name delimiter for nested variables (i.e. __)")
+	lintCmd.Flags().StringArrayVar(&renderSources, "source", nil, "variable source TYPE[:PATH] (env, dotenv, file, dir, stdin, vault, consul) in ascending precedence (repeatable)")
+	lintCmd.Flags().StringArrayVar(&renderFileRoots, "file-root", nil, "dir go template file functions may access (repeatable)")
+	lintCmd.Flags().BoolVar(&renderFileVars, "file-vars", false, "set FOO from FOO_FILE for every env var ending in _FILE, WARNING: includes unrelated vars (i.e. LOG_FILE) which can abort startup, prefer --file-var")
+	lintCmd.Flags().StringArrayVar(&renderFileVarNames, "file-var", nil, "set FOO to the contents of the file named by the FOO_FILE env var (repeatable)")
+	lintCmd.Flags().BoolVar(&lintStrict, "strict", false, "fail when referenced variables are not set")
+	rootCmd.AddCommand(lintCmd)
+
+	patchCmd.SetUsageTemplate(usageTpl("[OPTIONS] [CONFIG_PATH]"))
+	patchCmd.Flags().StringVarP(&renderDefaultCfgPath, "default-cfg-path", "c", "", "default config path")
+	patchCmd.Flags().StringArrayVarP(&patchSets, "set", "s", nil, "KEY.PATH=VALUE to set in the config (repeatable)")
+	patchCmd.Flags().StringVar(&patchMappingPath, "mapping", "", "YAML or JSON file mapping env var names to config key paths")
+	patchCmd.Flags().StringArrayVar(&renderSources, "source", nil, "variable source TYPE[:PATH] (env, dotenv, file, dir, stdin, vault, consul) in ascending precedence (repeatable)")
+	patchCmd.Flags().BoolVar(&renderFileVars, "file-vars", false, "set FOO from FOO_FILE for every env var ending in _FILE, WARNING: includes unrelated vars (i.e. LOG_FILE) which can abort startup, prefer --file-var")
+	patchCmd.Flags().StringArrayVar(&renderFileVarNames, "file-var", nil, "set FOO to the contents of the file named by the FOO_FILE env var (repeatable)")
+	patchCmd.Flags().StringVar(&patchCfgFormat, "format", "", "config format (yaml, json, toml, ini) (default from config path extension)")
+	rootCmd.AddCommand(patchCmd)
+
 	showCmd.SetUsageTemplate(usageTpl("COMMAND"))
 	rootCmd.AddCommand(showCmd)
 	showEnvConfCmd.SetUsageTemplate(usageTpl(""))
@@ -83,19 +207,358 @@ func handleGlobalFlags(cmd *cobra.Command) {
 	}
 }
 
+func handleManifest(cmd *cobra.Command) (err error) {
+	if path := redact.GetEnvInstance().ResolveManifestPathDefault(renderManifestPath); len(path) != 0 {
+		log.Printf(cmd.CommandPath()+": loading manifest %s", path)
+		if manifest, err = redact.LoadManifest(path); err != nil {
+			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		}
+	}
+	return nil
+}
+
+// handleSources merges variables from every manifest and --source variable
+// source into the env in ascending precedence. The process env takes
+// precedence over all other sources unless explicitly listed as a source.
+func handleSources(cmd *cobra.Command) error {
+	var specs []string
+	if manifest != nil {
+		specs = append(specs, manifest.Sources...)
+	}
+	specs = append(specs, renderSources...)
+	if len(specs) == 0 {
+		return nil
+	}
+	varSources = nil
+	var hasEnv bool
+	for _, spec := range specs {
+		source, err := redact.ParseSource(spec)
+		if err != nil {
+			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		}
+		switch s := source.(type) {
+		case *redact.EnvSource:
+			hasEnv = true
+		case *redact.ConsulSource:
+			// consul keys are loaded as nested vars when nesting is enabled
+			if nestDelim := resolveNestDelim(redact.GetEnvInstance()); len(nestDelim) != 0 {
+				s.KeySep = nestDelim
+			}
+		}
+		log.Printf(cmd.CommandPath()+": loading variable source %s", spec)
+		varSources = append(varSources, source)
+	}
+	var sources = varSources
+	if !hasEnv {
+		sources = append(sources, new(redact.EnvSource))
+	}
+	vars, err := redact.LoadSources(sources)
+	if err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	redact.GetEnvInstance().Merge(vars)
+	return nil
+}
+
 func handlePreRenderScript(cmd *cobra.Command) error {
-	if len(renderScript) != 0 {
-		prectx := new(redact.PreRenderContext)
-		log.Printf(cmd.CommandPath()+": executing pre-render script %s", renderScript)
-		env, err := prectx.Exec(renderScript)
-		// print script output from stdout if any
-		if len(prectx.StdOut) != 0 {
-			log.Print(prectx.StdOut)
+	var env = redact.GetEnvInstance()
+	hooks, err := resolvePreRenderHooks(env)
+	if err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	var mode = resolvePreRenderMode(env)
+	filter, err := resolvePreRenderFilter(env)
+	if err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	values, mask := resolvePreRenderReport(env)
+	for _, hook := range hooks {
+		log.Printf(cmd.CommandPath()+": executing pre-render script %s", hook.Path)
+		vars, err := hook.Run(mode, env.Environ(), func(attempt redact.PreRenderAttempt) {
+			logPreRenderAttempt(cmd, hook, attempt)
+		})
+		if err != nil {
+			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		}
+		if vars == nil {
+			continue
+		}
+		diff := redact.DiffPreRenderVars(env.ToMap(), vars, mode, filter)
+		for _, line := range diff.Report(values, mask) {
+			log.Printf(cmd.CommandPath()+": pre-render script %s %s", hook.Path, line)
+		}
+		diff.Apply(env)
+	}
+	return nil
+}
+
+// resolvePreRenderFilter returns the var name globs pre-render scripts may or
+// may not set where flags take precedence over manifest globs
+func resolvePreRenderFilter(env *redact.Env) (redact.PreRenderFilter, error) {
+	var allow, deny = renderScriptAllow, renderScriptDeny
+	if manifest != nil {
+		if len(allow) == 0 {
+			allow = manifest.PreRenderAllow
+		}
+		if len(deny) == 0 {
+			deny = manifest.PreRenderDeny
+		}
+	}
+	var filter redact.PreRenderFilter
+	var err error
+	if filter.Allow, err = env.ResolvePreRenderAllowDefault(allow); err != nil {
+		return filter, err
+	}
+	filter.Deny, err = env.ResolvePreRenderDenyDefault(deny)
+	return filter, err
+}
+
+// resolvePreRenderReport returns whether pre-render reports include values
+// and the var name parts whose values are masked where flags take precedence
+// over the manifest
+func resolvePreRenderReport(env *redact.Env) (bool, []string) {
+	var values, mask = renderScriptValues, renderScriptMask
+	if manifest != nil {
+		values = values || manifest.PreRenderReportValues
+		if len(mask) == 0 {
+			mask = manifest.PreRenderMask
+		}
+	}
+	if len(mask) == 0 {
+		mask = redact.DefaultSecretNameParts
+	}
+	return env.ResolvePreRenderReportValuesDefault(values), env.ResolvePreRenderMaskDefault(mask)
+}
+
+// resolvePreRenderHooks returns every pre-render hook in execution order:
+// --pre-render flags, manifest hooks, RDCT_PRE_RENDER_N env vars then the
+// scripts of the pre-render dir
+func resolvePreRenderHooks(env *redact.Env) ([]redact.PreRenderHook, error) {
+	var specs = append([]string{}, renderScripts...)
+	var dir = renderScriptDir
+	if manifest != nil {
+		specs = append(specs, manifest.PreRender...)
+		if len(dir) == 0 {
+			dir = manifest.PreRenderDir
+		}
+	}
+	var hooks []redact.PreRenderHook
+	for _, spec := range specs {
+		hook, err := redact.ParsePreRenderHook(spec)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	indexed, err := env.ResolvePreRenderHooks()
+	if err != nil {
+		return nil, err
+	}
+	hooks = append(hooks, indexed...)
+	if dir = env.ResolvePreRenderDirDefault(dir); len(dir) != 0 {
+		dirHook, err := redact.ParsePreRenderHook(dir)
+		if err != nil {
+			return nil, err
 		}
+		dirHooks, err := redact.PreRenderHookDir(dirHook, resolvePreRenderMode(env))
 		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, dirHooks...)
+	}
+	return hooks, nil
+}
+
+// logPreRenderAttempt logs the output of a pre-render hook attempt and whether
+// it is retried or skipped after failing
+func logPreRenderAttempt(cmd *cobra.Command, hook redact.PreRenderHook, attempt redact.PreRenderAttempt) {
+	// print script output from stdout if any
+	if len(attempt.Context.StdOut) != 0 {
+		log.Print(attempt.Context.StdOut)
+	}
+	switch {
+	case attempt.Err == nil:
+		// a failed script's stderr is part of the error
+		if len(attempt.Context.StdErr) != 0 {
+			log.Printf(cmd.CommandPath()+": pre-render script %s stderr:\n%s", hook.Path, attempt.Context.StdErr)
+		}
+	case attempt.Retry:
+		log.Printf(cmd.CommandPath()+": pre-render script %s failed, retrying in %s: %s", hook.Path, attempt.Backoff, attempt.Err)
+	case hook.ContinueOnError:
+		log.Printf(cmd.CommandPath()+": pre-render script %s failed, continuing: %s", hook.Path, attempt.Err)
+	}
+}
+
+func handleFileVars(cmd *cobra.Command) error {
+	var env = redact.GetEnvInstance()
+	var names = env.ResolveFileVarNamesDefault(renderFileVarNames)
+	if len(names) == 0 && !env.ResolveFileVarsEnabledDefault(renderFileVars) {
+		return nil
+	}
+	if len(names) == 0 {
+		log.Print(cmd.CommandPath() + ": warning: setting a var from every _FILE env var, use --file-var to limit them")
+	}
+	if err := env.ResolveFileVars(names...); err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	return nil
+}
+
+func handleTplOptions(cmd *cobra.Command) {
+	var env = redact.GetEnvInstance()
+	var coerce = renderCoerce
+	var types = make(map[string]string)
+	if manifest != nil {
+		coerce = coerce || manifest.Coerce
+		for name, typ := range manifest.Types {
+			types[name] = typ
+		}
+	}
+	// declared env var types take precedence over manifest types
+	for name, typ := range env.ResolveVarTypes() {
+		types[name] = typ
+	}
+	redact.TplOptions.Strict = env.ResolveStrictDefault(renderStrict)
+	redact.TplOptions.Coerce = env.ResolveCoerceDefault(coerce)
+	redact.TplOptions.Types = types
+	redact.TplOptions.NestDelim = resolveNestDelim(env)
+	var fileRoots = renderFileRoots
+	if manifest != nil && len(fileRoots) == 0 {
+		fileRoots = manifest.FileRoots
+	}
+	redact.TplOptions.FileRoots = env.ResolveFileRootsDefault(fileRoots)
+}
+
+// resolveNestDelim returns the nested var name delimiter in the resolution
+// order defined by `ResolveNestDelimDefault` where the --nest-delim flag takes
+// precedence over the manifest delimiter
+func resolveNestDelim(env *redact.Env) string {
+	var nestDelim = renderNestDelim
+	if manifest != nil && len(nestDelim) == 0 {
+		nestDelim = manifest.NestDelim
+	}
+	return env.ResolveNestDelimDefault(nestDelim)
+}
+
+// resolvePreRenderMode returns the pre-render script mode in the resolution
+// order defined by `ResolvePreRenderModeDefault` where the --pre-render-mode
+// flag takes precedence over the manifest mode
+func resolvePreRenderMode(env *redact.Env) string {
+	var mode = renderScriptMode
+	if manifest != nil && len(mode) == 0 {
+		mode = manifest.PreRenderMode
+	}
+	return env.ResolvePreRenderModeDefault(mode)
+}
+
+// resolveTplEngine returns the template engine in the resolution order defined
+// by `ResolveTplEngineDefault` where an explicitly set --default-tpl-engine flag
+// takes precedence over the manifest engine
+func resolveTplEngine(cmd *cobra.Command, env *redact.Env) string {
+	var engine = renderEngine
+	if manifest != nil && len(manifest.Engine) != 0 && !cmd.Flags().Changed("default-tpl-engine") {
+		engine = manifest.Engine
+	}
+	return env.ResolveTplEngineDefault(engine)
+}
+
+// resolveTargets returns every template to config file pair to render: the
+// default pair followed by any manifest or indexed env var pairs and finally
+// any --render flag pairs. Targets without a mode or owner get the resolved
+// config mode and owner where `defaultOwner` is used in place of --cfg-owner
+// if not set.
+func resolveTargets(cmd *cobra.Command, env *redact.Env, tplEngine, defaultOwner string) ([]redact.RenderTarget, error) {
+	var targets []redact.RenderTarget
+	// resolve config mode and owner
+	cfgMode, err := env.ResolveCfgModeDefault(renderCfgMode)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	if len(renderCfgOwner) != 0 {
+		defaultOwner = renderCfgOwner
+	}
+	var cfgOwner = env.ResolveCfgOwnerDefault(defaultOwner)
+	// resolve default template and config path
+	if tplPath := env.ResolveTplPathDefault(renderDefaultTplPath); len(tplPath) != 0 {
+		var cfgPath = env.ResolveCfgPathDefault(renderDefaultCfgPath)
+		if len(cfgPath) == 0 {
+			return nil, errors.New(cmd.CommandPath() + ": empty RDCT_DEFAULT_CFG_PATH or RDCT_CFG_PATH or --default-cfg-path not specified")
+		}
+		targets = append(targets, redact.RenderTarget{TplPath: tplPath, CfgPath: cfgPath, Engine: tplEngine})
+	}
+	// resolve manifest and indexed env var targets
+	var defaults []redact.RenderTarget
+	if manifest != nil {
+		if defaults, err = manifest.Targets(); err != nil {
+			return nil, errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		}
+	}
+	indexed, err := env.ResolveTargetsDefault(defaults, tplEngine)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	targets = append(targets, indexed...)
+	// resolve flag targets
+	for _, s := range renderTargets {
+		t, err := redact.ParseRenderTarget(s, tplEngine)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return nil, errors.New(cmd.CommandPath() + ": empty RDCT_DEFAULT_TPL_PATH or RDCT_TPL_PATH or --default-tpl-path not specified")
+	}
+	for i := range targets {
+		if targets[i].Mode == 0 {
+			targets[i].Mode = cfgMode
+		}
+		if len(targets[i].Owner) == 0 {
+			targets[i].Owner = cfgOwner
+		}
+	}
+	return targets, nil
+}
+
+// renderPassthrough renders env vars with the --env-prefix directly to a
+// config file or stdout without a template
+func renderPassthrough(cmd *cobra.Command, env *redact.Env) error {
+	var p = &redact.Passthrough{
+		Prefix:       renderEnvPrefix,
+		Case:         renderKeyCase,
+		Replacements: redact.DefaultKeyReplacements,
+		Format:       renderFormat,
+	}
+	if len(renderKeyReplace) != 0 {
+		p.Replacements = nil
+		for _, r := range renderKeyReplace {
+			pair := strings.SplitN(r, "=", 2)
+			if len(pair) != 2 || len(pair[0]) == 0 {
+				return errors.New(cmd.CommandPath() + ": invalid key replacement (expected OLD=NEW): " + r)
+			}
+			p.Replacements = append(p.Replacements, pair[0], pair[1])
+		}
+	}
+	// resolve config path
+	var cfgPath = env.ResolveCfgPathDefault(renderDefaultCfgPath)
+	if len(renderOutPath) != 0 {
+		cfgPath = renderOutPath
+	}
+	if len(cfgPath) == 0 { // no cfgPath so we render to stdout
+		log.Printf(cmd.CommandPath()+": rendering %s env vars", renderEnvPrefix)
+		if err := redact.RenderPassthroughStdOut(p); err != nil {
 			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
 		}
-		redact.GetEnvInstance().Merge(env)
+		return nil
+	}
+	// resolve config mode and owner
+	cfgMode, err := env.ResolveCfgModeDefault(renderCfgMode)
+	if err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	log.Printf(cmd.CommandPath()+": rendering %s env vars to %s", renderEnvPrefix, cfgPath)
+	if err = redact.RenderPassthroughFile(p, cfgPath, cfgMode, env.ResolveCfgOwnerDefault(renderCfgOwner)); err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
 	}
 	return nil
 }
@@ -113,16 +576,57 @@ var renderCmd = &cobra.Command{
 	Use:   "render",
 	Short: "Render configuration from template file",
 	Long: `Render configuration from template file. By default, the template
-is rendered to stdout`,
+is rendered to stdout. When a manifest is specified without a template path
+arg, every manifest template is rendered to its config path.
+
+When the template path is a directory, every file matching a template suffix
+is rendered to the output directory with the suffix stripped and all other
+files are copied as is.
+
+With --env-prefix, no template is used and every env var with the prefix is
+translated to a config key (i.e. KAFKA_LOG_RETENTION_HOURS to
+log.retention.hours) and rendered in the --format`,
 	Args: cobra.RangeArgs(0, 1),
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		var env = redact.GetEnvInstance()
+		// handle manifest
+		if err = handleManifest(cmd); err != nil {
+			return err
+		}
+		// handle variable sources
+		if err = handleSources(cmd); err != nil {
+			return err
+		}
 		// handle pre-render script
 		if err = handlePreRenderScript(cmd); err != nil {
 			return err
 		}
+		// handle file vars
+		if err = handleFileVars(cmd); err != nil {
+			return err
+		}
+		// handle template options
+		handleTplOptions(cmd)
 		// resolve template engine
-		var tplEngine = env.ResolveTplEngineDefault(renderEngine)
+		var tplEngine = resolveTplEngine(cmd, env)
+		// render all manifest templates when no template path arg is specified
+		if manifest != nil && len(args) == 0 {
+			targets, err := resolveTargets(cmd, env, tplEngine, "")
+			if err != nil {
+				return err
+			}
+			for _, t := range targets {
+				log.Printf(cmd.CommandPath()+": rendering template %s to %s", t.TplPath, t.CfgPath)
+			}
+			if err = redact.RenderCfgFiles(targets); err != nil {
+				return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+			}
+			return nil
+		}
+		// render env vars directly without a template
+		if len(renderEnvPrefix) != 0 {
+			return renderPassthrough(cmd, env)
+		}
 		// resolve template path
 		var tplPath = env.ResolveTplPathDefault(renderDefaultTplPath)
 		if len(args) != 0 {
@@ -137,14 +641,34 @@ is rendered to stdout`,
 			cfgPath = renderOutPath
 		}
 		// render
-		if len(cfgPath) == 0 { // no cfgPath so we render to stdout
+		if info, err := os.Stat(tplPath); err == nil && info.IsDir() {
+			if len(cfgPath) == 0 {
+				return errors.New(cmd.CommandPath() + ": output directory not specified for template directory " + tplPath)
+			}
+			log.Printf(cmd.CommandPath()+": rendering template directory %s to %s", tplPath, cfgPath)
+			if err = redact.RenderCfgDir(tplPath, cfgPath, tplEngine, renderSuffixes); err != nil {
+				return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+			}
+		} else if len(cfgPath) == 0 { // no cfgPath so we render to stdout
 			log.Printf(cmd.CommandPath()+": rendering template %s", tplPath)
 			if err = redact.RenderCfgStdOut(tplPath, tplEngine); err != nil {
 				return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
 			}
 		} else {
+			// resolve config mode and owner
+			cfgMode, err := env.ResolveCfgModeDefault(renderCfgMode)
+			if err != nil {
+				return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+			}
+			var target = redact.RenderTarget{
+				TplPath: tplPath,
+				CfgPath: cfgPath,
+				Engine:  tplEngine,
+				Mode:    cfgMode,
+				Owner:   env.ResolveCfgOwnerDefault(renderCfgOwner),
+			}
 			log.Printf(cmd.CommandPath()+": rendering template %s to %s", tplPath, cfgPath)
-			if err = redact.RenderCfgFile(tplPath, cfgPath, tplEngine); err != nil {
+			if err = redact.RenderCfgFiles([]redact.RenderTarget{target}); err != nil {
 				return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
 			}
 		}
@@ -162,6 +686,9 @@ Example: redact exec -- nobody id
          redact exec -- nobody:root id`,
 	Args: cobra.MinimumNArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if execSupervise {
+			return superviseCmd(cmd, args)
+		}
 		log.Printf(cmd.CommandPath()+": with userspec `%s`, executing command `%s`", args[0], args[1])
 		if err = libgosu.Exec(args[0], args[1:]); err != nil {
 			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
@@ -170,6 +697,18 @@ Example: redact exec -- nobody id
 	},
 }
 
+// superviseCmd runs the command as a child process forwarding every signal to
+// it and reaping zombies then sets the exit code to the exit code of the child
+func superviseCmd(cmd *cobra.Command, args []string) error {
+	log.Printf(cmd.CommandPath()+": with userspec `%s`, supervising command `%s`", args[0], args[1])
+	code, err := redact.NewSupervisor(args[0], args[1:]).Run()
+	if err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	exitCode = code
+	return nil
+}
+
 var entrypointCmd = &cobra.Command{
 	Use:   "entrypoint",
 	Short: "Renders configuration then executes a command",
@@ -181,31 +720,299 @@ Example: redact entrypoint -- nobody id
 	Args: cobra.MinimumNArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		log.Print(versionString)
+		// handle manifest
+		if err = handleManifest(cmd); err != nil {
+			return err
+		}
+		// render
+		targets, err := renderEntrypoint(cmd, args)
+		if err != nil {
+			return err
+		}
+		// supervised command execution
+		if entrypointWatch {
+			return watchEntrypoint(cmd, args, targets)
+		}
+		if execSupervise {
+			return superviseCmd(cmd, args)
+		}
+		// command execution
+		log.Printf(cmd.CommandPath()+": with userspec `%s`, executing command `%s`", args[0], args[1])
+		if err = libgosu.Exec(args[0], args[1:]); err != nil {
+			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		}
+		return nil
+	},
+}
+
+// renderEntrypoint resolves every variable and renders every entrypoint target
+// returning the rendered targets
+func renderEntrypoint(cmd *cobra.Command, args []string) ([]redact.RenderTarget, error) {
+	var env = redact.GetEnvInstance()
+	// handle variable sources
+	if err := handleSources(cmd); err != nil {
+		return nil, err
+	}
+	// handle pre-render script
+	if err := handlePreRenderScript(cmd); err != nil {
+		return nil, err
+	}
+	// handle file vars
+	if err := handleFileVars(cmd); err != nil {
+		return nil, err
+	}
+	// handle template options
+	handleTplOptions(cmd)
+	// resolve template engine
+	var tplEngine = resolveTplEngine(cmd, env)
+	// resolve templates and config paths
+	var defaultOwner string
+	if entrypointOwnerUserspec {
+		defaultOwner = args[0]
+	}
+	targets, err := resolveTargets(cmd, env, tplEngine, defaultOwner)
+	if err != nil {
+		return nil, err
+	}
+	// resolve post-render hooks
+	hooks, err := resolvePostRenderHooks(cmd, env)
+	if err != nil {
+		return nil, err
+	}
+	// render where post-render hooks run against the replaced config files
+	// which are rolled back if any of them fail
+	for _, t := range targets {
+		log.Printf(cmd.CommandPath()+": rendering template %s to %s", t.TplPath, t.CfgPath)
+	}
+	err = redact.RenderCfgFilesVerified(targets, func(targets []redact.RenderTarget) error {
+		return runPostRenderHooks(cmd, hooks, targets)
+	})
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	return targets, nil
+}
+
+// resolvePostRenderHooks returns every post-render hook in execution order:
+// --post-render flags, manifest hooks then RDCT_POST_RENDER_N env vars
+func resolvePostRenderHooks(cmd *cobra.Command, env *redact.Env) ([]redact.PostRenderHook, error) {
+	var specs = append([]string{}, entrypointPostRender...)
+	if manifest != nil {
+		specs = append(specs, manifest.PostRender...)
+	}
+	var hooks []redact.PostRenderHook
+	for _, spec := range specs {
+		hook, err := redact.ParsePostRenderHook(spec)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		}
+		hooks = append(hooks, hook)
+	}
+	indexed, err := env.ResolvePostRenderHooks()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	return append(hooks, indexed...), nil
+}
+
+// runPostRenderHooks runs every post-render hook in order against the rendered
+// targets where the first failed hook aborts startup
+func runPostRenderHooks(cmd *cobra.Command, hooks []redact.PostRenderHook, targets []redact.RenderTarget) error {
+	var env = redact.GetEnvInstance()
+	for _, hook := range hooks {
+		postctx := &redact.PostRenderContext{Env: env.Environ()}
+		log.Printf(cmd.CommandPath()+": executing post-render hook `%s`", strings.Join(hook.Args, " "))
+		err := postctx.Exec(hook, targets)
+		// print hook output if any
+		if len(postctx.StdOut) != 0 {
+			log.Print(postctx.StdOut)
+		}
+		if err != nil {
+			return errors.New(fmt.Sprint("post-render hook failed: ", err))
+		}
+		if len(postctx.StdErr) != 0 {
+			log.Print(postctx.StdErr)
+		}
+	}
+	return nil
+}
+
+// watchEntrypoint runs the command as a child process then re-renders every
+// time a template or file based variable source changes and either signals or
+// restarts the child. A failed re-render leaves the config and child as is and
+// a failed post-render hook rolls back the config without touching the child.
+// Like supervise, every signal is forwarded to the child, zombies are reaped
+// and the exit code is set to the exit code of the child.
+func watchEntrypoint(cmd *cobra.Command, args []string, targets []redact.RenderTarget) error {
+	sig, err := redact.ParseSignal(entrypointWatchSignal)
+	if err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	var paths = redact.WatchPaths(varSources)
+	for _, t := range targets {
+		paths = append(paths, t.TplPath)
+	}
+	watcher, err := redact.NewWatcher(paths, entrypointWatchDebounce)
+	if err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	defer watcher.Close()
+	log.Printf(cmd.CommandPath()+": with userspec `%s`, supervising command `%s`", args[0], args[1])
+	var supervisor = redact.NewSupervisor(args[0], args[1:])
+	if err = supervisor.Start(); err != nil {
+		return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+	}
+	var signals = make(chan os.Signal, 32)
+	signal.Notify(signals)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-supervisor.Done():
+			exitCode = supervisor.ExitCode()
+			return nil
+		case s := <-signals:
+			supervisor.Forward(s)
+		case err = <-watcher.Errors:
+			log.Printf(cmd.CommandPath()+": watch error: %s", err)
+		case changed := <-watcher.Changes:
+			log.Printf(cmd.CommandPath()+": changed %s, re-rendering", strings.Join(changed, ", "))
+			redact.ResetEnvInstance()
+			// pre-render scripts are waited on by redact rather than reaped
+			supervisor.WithoutReaping(func() {
+				_, err = renderEntrypoint(cmd, args)
+			})
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			if entrypointWatchRestart {
+				log.Printf(cmd.CommandPath()+": restarting command `%s`", args[1])
+				if err = supervisor.Restart(10 * time.Second); err != nil {
+					return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+				}
+				continue
+			}
+			log.Printf(cmd.CommandPath()+": sending %s to command `%s`", entrypointWatchSignal, args[1])
+			if err = supervisor.Signal(sig); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "List variables referenced by a template",
+	Long: `List every variable referenced by a template along with the template
+lines referencing it and whether it is currently set. Template syntax errors
+are reported with their line numbers`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		var env = redact.GetEnvInstance()
-		// handle pre-render script
-		if err = handlePreRenderScript(cmd); err != nil {
+		// handle variable sources
+		if err = handleSources(cmd); err != nil {
 			return err
 		}
+		// handle file vars
+		if err = handleFileVars(cmd); err != nil {
+			return err
+		}
+		// handle template options
+		handleTplOptions(cmd)
 		// resolve template engine
 		var tplEngine = env.ResolveTplEngineDefault(renderEngine)
 		// resolve template path
 		var tplPath = env.ResolveTplPathDefault(renderDefaultTplPath)
+		if len(args) != 0 {
+			tplPath = args[0]
+		}
 		if len(tplPath) == 0 {
-			return errors.New(cmd.CommandPath() + ": empty RDCT_DEFAULT_TPL_PATH or RDCT_TPL_PATH or --default-tpl-path not specified")
+			return errors.New(cmd.CommandPath() + ": empty RDCT_DEFAULT_TPL_PATH or RDCT_TPL_PATH or template path arg not specified")
+		}
+		vars, err := redact.LintTpl(tplPath, tplEngine)
+		if err != nil {
+			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		}
+		format := fmt.Sprintf("%%-%ds%%-9s%%s", func() (w int) {
+			for _, v := range vars {
+				if len(v.Name) > w {
+					w = len(v.Name)
+				}
+			}
+			return w + 1 // pad one col
+		}())
+		var unset int
+		for _, v := range vars {
+			var status = "set"
+			if !v.Set && v.Optional {
+				status = "optional"
+			} else if !v.Set {
+				status = "unset"
+				unset++
+			}
+			lines := make([]string, len(v.Lines))
+			for i, line := range v.Lines {
+				lines[i] = strconv.Itoa(line)
+			}
+			log.Printf(format, v.Name, status, "line "+strings.Join(lines, ", "))
+		}
+		if lintStrict && unset != 0 {
+			return errors.New(fmt.Sprintf(cmd.CommandPath()+": %d referenced variables not set", unset))
+		}
+		return nil
+	},
+}
+
+var patchCmd = &cobra.Command{
+	Use:   "patch",
+	Short: "Override keys in an existing configuration file",
+	Long: `Override keys in an existing YAML, JSON, TOML or INI configuration file
+and atomically write the result back. Keys are set from RDCT_SET__ env vars
+where "__" separates key path segments (i.e. RDCT_SET__server__port=8080 sets
+server.port), from env vars named in a --mapping file and finally from --set
+flags`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var env = redact.GetEnvInstance()
+		// handle variable sources
+		if err = handleSources(cmd); err != nil {
+			return err
+		}
+		// handle file vars
+		if err = handleFileVars(cmd); err != nil {
+			return err
 		}
 		// resolve config path
 		var cfgPath = env.ResolveCfgPathDefault(renderDefaultCfgPath)
+		if len(args) != 0 {
+			cfgPath = args[0]
+		}
 		if len(cfgPath) == 0 {
-			return errors.New(cmd.CommandPath() + ": empty RDCT_DEFAULT_CFG_PATH or RDCT_CFG_PATH or --default-cfg-path not specified")
+			return errors.New(cmd.CommandPath() + ": empty RDCT_DEFAULT_CFG_PATH or RDCT_CFG_PATH or config path arg not specified")
 		}
-		// render
-		log.Printf(cmd.CommandPath()+": rendering template %s to %s", tplPath, cfgPath)
-		if err = redact.RenderCfgFile(tplPath, cfgPath, tplEngine); err != nil {
-			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+		// resolve patch sets
+		var sets = env.ResolvePatchSets()
+		if len(patchMappingPath) != 0 {
+			mapped, err := env.ResolvePatchMapping(patchMappingPath)
+			if err != nil {
+				return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+			}
+			sets = append(sets, mapped...)
 		}
-		// command execution
-		log.Printf(cmd.CommandPath()+": with userspec `%s`, executing command `%s`", args[0], args[1])
-		if err = libgosu.Exec(args[0], args[1:]); err != nil {
+		for _, s := range patchSets {
+			set, err := redact.ParsePatchSet(s)
+			if err != nil {
+				return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
+			}
+			sets = append(sets, set)
+		}
+		if len(sets) == 0 {
+			log.Printf(cmd.CommandPath()+": nothing to patch in %s", cfgPath)
+			return nil
+		}
+		// patch
+		log.Printf(cmd.CommandPath()+": patching %d keys in %s", len(sets), cfgPath)
+		if err = redact.PatchCfgFile(cfgPath, patchCfgFormat, sets); err != nil {
 			return errors.New(fmt.Sprint(cmd.CommandPath()+": ", err))
 		}
 		return nil
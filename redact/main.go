@@ -2,11 +2,16 @@ package main
 
 import (
 	"log"
+	"os"
 	"runtime"
 )
 
 var version = "dev"
 
+// exitCode is the exit code of redact once the command completes i.e. the exit
+// code of a supervised child process
+var exitCode int
+
 func init() {
 	runtime.GOMAXPROCS(1)
 	runtime.LockOSThread()
@@ -14,5 +19,8 @@ func init() {
 
 func main() {
 	log.SetFlags(0)
-	rootCmd.Execute()
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(exitCode)
 }
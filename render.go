@@ -1,33 +1,300 @@
 package redact
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/emacski/redact/template"
 )
 
 const writeBufferSize = 1024 * 1024 // 1MB
 
+// TplOptions are the template rendering options used for every render
+var TplOptions template.Options
+
+// DefaultTplSuffixes are the file suffixes identifying templates when
+// rendering a template directory
+var DefaultTplSuffixes = []string{".redacted", ".mustache"}
+
+// RenderTarget represents a template to be rendered to a config file
+type RenderTarget struct {
+	TplPath string
+	CfgPath string
+	Engine  string
+	Mode    os.FileMode // config file mode, left unchanged if zero
+	Owner   string      // config file owner user spec, left unchanged if empty
+}
+
+// ParseRenderTarget parses a render target from a string in the form
+// TEMPLATE_PATH:CONFIG_PATH using `engine` as the template engine
+func ParseRenderTarget(s, engine string) (RenderTarget, error) {
+	pair := strings.SplitN(s, ":", 2)
+	if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+		return RenderTarget{}, errors.New("invalid render target (expected TEMPLATE_PATH:CONFIG_PATH): " + s)
+	}
+	return RenderTarget{TplPath: pair[0], CfgPath: pair[1], Engine: engine}, nil
+}
+
 // RenderCfgStdOut renders a configuration to stdout using the service config
 func RenderCfgStdOut(tplPath, engine string) error {
 	return RenderCfg(tplPath, engine, os.Stdout)
 }
 
-// RenderCfgFile renders a configuration to a file using the service config
+// RenderCfgFile renders a configuration to a file using the service config.
+// The config file is replaced atomically so that it is left untouched if
+// rendering fails.
 func RenderCfgFile(tplPath, cfgPath, engine string) error {
-	f, err := os.Create(cfgPath)
+	return writeCfgAtomic(cfgPath, 0, "", func(w io.Writer) error {
+		return RenderCfg(tplPath, engine, w)
+	})
+}
+
+// RenderCfgFiles renders each target to its config file. All targets are
+// rendered and written to temp files before any config file is replaced so
+// that a single failing template leaves every config file untouched
+func RenderCfgFiles(targets []RenderTarget) error {
+	return RenderCfgFilesVerified(targets, nil)
+}
+
+// RenderCfgFilesVerified renders each target to its config file the same as
+// `RenderCfgFiles` where `verify`, if not nil, is called with the targets once
+// every config file is replaced (i.e. to validate them or run a migration).
+// If `verify` fails, every config file is rolled back to its previous
+// contents, or removed if it didn't exist before.
+func RenderCfgFilesVerified(targets []RenderTarget, verify func(targets []RenderTarget) error) error {
+	rendered := make([][]byte, len(targets))
+	for i, t := range targets {
+		var buf bytes.Buffer
+		if err := RenderCfg(t.TplPath, t.Engine, &buf); err != nil {
+			return errors.New(fmt.Sprint(t.TplPath, ": ", err))
+		}
+		rendered[i] = buf.Bytes()
+	}
+	var pending, backups []*pendingCfg
+	discard := func(pending []*pendingCfg) {
+		for _, p := range pending {
+			if p != nil {
+				p.discard()
+			}
+		}
+	}
+	for i, t := range targets {
+		p, err := writeCfgTemp(t.CfgPath, t.Mode, t.Owner, writeBytes(rendered[i]))
+		if err != nil {
+			discard(pending)
+			discard(backups)
+			return err
+		}
+		pending = append(pending, p)
+		if verify == nil {
+			continue
+		}
+		backup, err := p.backupCfg()
+		if err != nil {
+			discard(pending)
+			discard(backups)
+			return err
+		}
+		backups = append(backups, backup)
+	}
+	for i, p := range pending {
+		if err := p.commit(); err != nil {
+			discard(pending[i+1:])
+			if verify != nil {
+				discard(backups[i:])
+				return rollbackErr(err, rollbackCfgs(pending[:i], backups[:i]))
+			}
+			return err
+		}
+	}
+	if verify == nil {
+		return nil
+	}
+	if err := verify(targets); err != nil {
+		return rollbackErr(err, rollbackCfgs(pending, backups))
+	}
+	discard(backups)
+	return nil
+}
+
+// rollbackCfgs rolls back every committed config in `pending` from its backup
+// returning the first error, if any, after attempting all of them
+func rollbackCfgs(pending, backups []*pendingCfg) error {
+	var firstErr error
+	for i, p := range pending {
+		if err := p.rollback(backups[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// rollbackErr returns `err` including `rbErr` if rolling back failed as well
+func rollbackErr(err, rbErr error) error {
+	if rbErr == nil {
+		return err
+	}
+	return errors.New(fmt.Sprint(err, " (rollback failed: ", rbErr, ")"))
+}
+
+// walkTplDir calls `fn` for `dir` and every entry of its tree in lexical
+// order. Unlike `filepath.Walk`, symlinks are followed (i.e. to dirs) and
+// hidden entries are skipped, which includes the "..data" and timestamped
+// dirs of kubernetes ConfigMap and Secret volumes whose files are symlinks
+// into them.
+func walkTplDir(dir string, fn func(path string, info os.FileInfo) error) error {
+	return walkTplDirSeen(dir, fn, make(map[string]bool))
+}
+
+// walkTplDirSeen walks `dir` where `seen` holds the resolved dirs already
+// walked so symlink loops are walked once
+func walkTplDirSeen(dir string, fn func(path string, info os.FileInfo) error, seen map[string]bool) error {
+	info, err := os.Stat(dir)
 	if err != nil {
 		return err
 	}
+	if err = fn(dir, info); err != nil || !info.IsDir() {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if seen[resolved] {
+		return nil
+	}
+	seen[resolved] = true
+	names, err := readDirNames(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if err = walkTplDirSeen(filepath.Join(dir, name), fn, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDirNames returns the sorted entry names of the dir at `dir`
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
 	defer f.Close()
-	// use buffered writer to prevent partially written files on error
-	w := bufio.NewWriterSize(f, writeBufferSize)
-	if err = RenderCfg(tplPath, engine, w); err != nil {
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// writeBytes returns a write func for `writeCfgAtomic` that writes `data`
+func writeBytes(data []byte) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
 		return err
 	}
-	w.Flush()
+}
+
+// RenderCfgDir renders every template in the `tplDir` directory tree to the
+// same relative path in `cfgDir` with the template suffix stripped. Files not
+// matching any of `suffixes` are copied verbatim and templates with the
+// ".mustache" suffix always use the mustache engine. Like `RenderCfgFiles`,
+// nothing is written unless every template renders successfully.
+func RenderCfgDir(tplDir, cfgDir, engine string, suffixes []string) error {
+	type dirFile struct {
+		path string
+		data []byte
+		mode os.FileMode
+	}
+	var files []dirFile
+	err := walkTplDir(tplDir, func(path string, info os.FileInfo) error {
+		rel, err := filepath.Rel(tplDir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			files = append(files, dirFile{path: filepath.Join(cfgDir, rel), mode: info.Mode()})
+			return nil
+		}
+		suffix := tplSuffix(rel, suffixes)
+		if len(suffix) == 0 { // not a template so copy
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, dirFile{filepath.Join(cfgDir, rel), data, info.Mode().Perm()})
+			return nil
+		}
+		var eng = engine
+		if suffix == "."+template.EngineTypeMustache {
+			eng = template.EngineTypeMustache
+		}
+		var buf bytes.Buffer
+		if err = RenderCfg(path, eng, &buf); err != nil {
+			return errors.New(fmt.Sprint(path, ": ", err))
+		}
+		files = append(files, dirFile{filepath.Join(cfgDir, strings.TrimSuffix(rel, suffix)), buf.Bytes(), info.Mode().Perm()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.mode.IsDir() {
+			if err = os.MkdirAll(f.path, f.mode.Perm()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = writeCfgAtomic(f.path, f.mode, "", writeBytes(f.data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tplSuffix returns the first suffix in `suffixes` that `path` ends with or
+// empty string if none match
+func tplSuffix(path string, suffixes []string) string {
+	for _, suffix := range suffixes {
+		if len(suffix) != 0 && strings.HasSuffix(path, suffix) && filepath.Base(path) != suffix {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// setCfgPerms sets the mode and owner of a config file where a zero mode or
+// empty owner leaves the respective attribute unchanged
+func setCfgPerms(cfgPath string, mode os.FileMode, owner string) error {
+	if mode != 0 {
+		if err := os.Chmod(cfgPath, mode); err != nil {
+			return err
+		}
+	}
+	if len(owner) != 0 {
+		u, err := lookupUser(owner)
+		if err != nil {
+			return err
+		}
+		if err = os.Chown(cfgPath, u.Uid, u.Gid); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -38,5 +305,5 @@ func RenderCfg(tplPath, engine string, w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	return template.New(tplPath, vars, eng).Render(w)
+	return template.NewWithOptions(tplPath, vars, eng, TplOptions).Render(w)
 }
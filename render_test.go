@@ -2,8 +2,14 @@ package redact
 
 import (
 	"bytes"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+
+	"github.com/emacski/redact/template"
 )
 
 var (
@@ -36,3 +42,500 @@ func TestRenderCfgMustacheEngine(t *testing.T) {
 		t.Error("Expected \"test=test\", got: ", rendered.String()[9])
 	}
 }
+
+func TestRenderCfgFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	targets := []RenderTarget{
+		{TplPath: tplPathGo, CfgPath: filepath.Join(dir, "go.conf"), Engine: "go"},
+		{TplPath: tplPathMustache, CfgPath: filepath.Join(dir, "mustache.conf"), Engine: "mustache"},
+	}
+	if err = RenderCfgFiles(targets); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range targets {
+		rendered, err := ioutil.ReadFile(target.CfgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rendered) != "test=test\n" {
+			t.Errorf("Expected \"test=test\" in %s, got: %s", target.CfgPath, rendered)
+		}
+	}
+	// a failing target must prevent all config files from being written
+	targets = []RenderTarget{
+		{TplPath: tplPathGo, CfgPath: filepath.Join(dir, "new.conf"), Engine: "go"},
+		{TplPath: "test/doesnt_exist", CfgPath: filepath.Join(dir, "fail.conf"), Engine: "go"},
+	}
+	if err = RenderCfgFiles(targets); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "new.conf")); !os.IsNotExist(err) {
+		t.Error("Expected new.conf to not exist, got: ", err)
+	}
+}
+
+func TestRenderCfgFilesVerified(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var cfgPath = filepath.Join(dir, "go.conf")
+	if err = ioutil.WriteFile(cfgPath, []byte("previous\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var newPath = filepath.Join(dir, "new.conf")
+	targets := []RenderTarget{
+		{TplPath: tplPathGo, CfgPath: cfgPath, Engine: "go"},
+		{TplPath: tplPathGo, CfgPath: newPath, Engine: "go"},
+	}
+	// verification runs against the replaced config files which are rolled
+	// back when it fails
+	err = RenderCfgFilesVerified(targets, func(verified []RenderTarget) error {
+		if verified[0].CfgPath != cfgPath || verified[0].TplPath != tplPathGo {
+			t.Error("Expected rendered target, got: ", verified[0])
+		}
+		for _, target := range verified {
+			if rendered, _ := ioutil.ReadFile(target.CfgPath); string(rendered) != "test=test\n" {
+				t.Errorf("Expected rendered config \"test=test\" for %s, got: %q", target.CfgPath, rendered)
+			}
+		}
+		return errors.New("invalid config")
+	})
+	if err == nil || err.Error() != "invalid config" {
+		t.Error("Expected invalid config error, got: ", err)
+	}
+	if rendered, _ := ioutil.ReadFile(cfgPath); string(rendered) != "previous\n" {
+		t.Errorf("Expected config to be rolled back, got: %q", rendered)
+	}
+	if names, _ := readDirNames(dir); len(names) != 1 {
+		t.Error("Expected new config and temp files to be removed, got: ", names)
+	}
+	err = RenderCfgFilesVerified(targets, func(verified []RenderTarget) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered, _ := ioutil.ReadFile(cfgPath); string(rendered) != "test=test\n" {
+		t.Errorf("Expected \"test=test\", got: %q", rendered)
+	}
+	if names, _ := readDirNames(dir); len(names) != 2 {
+		t.Error("Expected backup files to be removed, got: ", names)
+	}
+}
+
+func TestParseRenderTarget(t *testing.T) {
+	target, err := ParseRenderTarget("/path/to/template:/path/to/config", "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.TplPath != "/path/to/template" || target.CfgPath != "/path/to/config" || target.Engine != "go" {
+		t.Error("Unexpected render target: ", target)
+	}
+	if _, err = ParseRenderTarget("/path/to/template", "go"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestRenderCfgDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = RenderCfgDir("test/tpl-dir", dir, "go", DefaultTplSuffixes); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"app.conf":           "test=test\n",
+		"conf.d/extra.conf":  "test=test\n",
+		"conf.d/static.conf": "static=true\n",
+	}
+	for path, content := range expected {
+		rendered, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(rendered) != content {
+			t.Errorf("Expected %q in %s, got: %q", content, path, rendered)
+		}
+	}
+}
+
+func TestRenderCfgDirK8sVolume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a ConfigMap volume: files and dirs are symlinks into the ..data symlink
+	// to the timestamped dir holding the actual files
+	var tplDir, cfgDir = filepath.Join(dir, "tpl"), filepath.Join(dir, "cfg")
+	var dataDir = filepath.Join(tplDir, "..2024_01_01_00_00_00.000000000")
+	if err = os.MkdirAll(filepath.Join(dataDir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		"app.conf.redacted":          "test={{.test_app_var}}\n",
+		"conf.d/extra.conf.redacted": "extra={{.test_app_var}}\n",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dataDir, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Symlink(filepath.Base(dataDir), filepath.Join(tplDir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app.conf.redacted", "conf.d"} {
+		if err = os.Symlink(filepath.Join("..data", name), filepath.Join(tplDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = RenderCfgDir(tplDir, cfgDir, "go", DefaultTplSuffixes); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"app.conf":          "test=test\n",
+		"conf.d/extra.conf": "extra=test\n",
+	}
+	for path, content := range expected {
+		rendered, err := ioutil.ReadFile(filepath.Join(cfgDir, path))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(rendered) != content {
+			t.Errorf("Expected %q in %s, got: %q", content, path, rendered)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(cfgDir, "..data")); !os.IsNotExist(err) {
+		t.Error("Expected hidden ..data dir not to be rendered, got: ", err)
+	}
+}
+
+func TestRenderCfgFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfgPath := filepath.Join(dir, "app.conf")
+	if err = ioutil.WriteFile(cfgPath, []byte("default=true\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	// failed render must leave the existing config untouched
+	if err = RenderCfgFile("test/doesnt_exist", cfgPath, "go"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	rendered, err := ioutil.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rendered) != "default=true\n" {
+		t.Error("Expected \"default=true\", got: ", string(rendered))
+	}
+	// successful render must replace the config and keep its mode
+	if err = RenderCfgFile(tplPathGo, cfgPath, "go"); err != nil {
+		t.Fatal(err)
+	}
+	if rendered, err = ioutil.ReadFile(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+	if string(rendered) != "test=test\n" {
+		t.Error("Expected \"test=test\", got: ", string(rendered))
+	}
+	info, err := os.Stat(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Error("Expected mode to be 0640, got: ", info.Mode().Perm())
+	}
+	// no temp files must be left behind
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Error("Expected 1 file in config dir, got: ", len(files))
+	}
+}
+
+func TestRenderCfgFileSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// an existing and a dangling symlink must both be kept
+	for _, target := range []string{"existing.conf", "missing.conf"} {
+		var linkPath = filepath.Join(dir, "link-"+target)
+		if err = os.Symlink(target, linkPath); err != nil {
+			t.Fatal(err)
+		}
+		if target == "existing.conf" {
+			if err = ioutil.WriteFile(filepath.Join(dir, target), []byte("default=true\n"), 0640); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = RenderCfgFile(tplPathGo, linkPath, "go"); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(linkPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Error("Expected ", linkPath, " to still be a symlink")
+		}
+		rendered, err := ioutil.ReadFile(filepath.Join(dir, target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rendered) != "test=test\n" {
+			t.Error("Expected \"test=test\", got: ", string(rendered))
+		}
+	}
+}
+
+func TestPendingCfgCommitInPlace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfgPath := filepath.Join(dir, "app.conf")
+	if err = ioutil.WriteFile(cfgPath, []byte("default=true\nlonger=than rendered\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	p, err := writeCfgTemp(cfgPath, 0600, "", writeBytes([]byte("test=test\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// i.e. a bind mounted config file can't be renamed over
+	if err = p.commitInPlace(); err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := ioutil.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rendered) != "test=test\n" {
+		t.Error("Expected \"test=test\", got: ", string(rendered))
+	}
+	if info, err := os.Stat(cfgPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Error("Expected mode to be 0600, got: ", info, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Error("Expected 1 file in config dir, got: ", len(files))
+	}
+	if !isMountErr(&os.LinkError{Op: "rename", Err: syscall.EBUSY}) || isMountErr(&os.LinkError{Op: "rename", Err: syscall.ENOENT}) {
+		t.Error("Expected only EBUSY to be a mount error")
+	}
+}
+
+func TestRenderCfgStrict(t *testing.T) {
+	TplOptions.Strict = true
+	defer func() { TplOptions.Strict = false }()
+	for path, engine := range map[string]string{"test/strict.redacted": "go", "test/strict.mustache": "mustache"} {
+		err := RenderCfg(path, engine, new(bytes.Buffer))
+		if err == nil {
+			t.Errorf("Expected err to be error for %s, got: nil", path)
+			continue
+		}
+		// test_missing_one is only a condition
+		expected := "missing variables: test_missing_two (line 3)"
+		if engine == "go" {
+			expected = "missing variables: test_missing_two (line 4)"
+		}
+		if err.Error() != expected {
+			t.Errorf("Expected %q for %s, got: %q", expected, path, err.Error())
+		}
+	}
+	// references within templates invoked with the root data
+	err := RenderCfg("test/strict-define.redacted", "go", new(bytes.Buffer))
+	if err == nil || err.Error() != "missing variables: test_missing_one (line 1)" {
+		t.Errorf("Expected missing test_missing_one (line 1) error, got: %v", err)
+	}
+	// optional variables in conditions, guarded by conditions or with defaults
+	for path, expected := range map[string]string{
+		"test/optional.redacted": "test=test\nfallback\n\ntwo=default\n",
+		"test/optional.mustache": "test=test\n\nfallback \n",
+	} {
+		var rendered = new(bytes.Buffer)
+		engine := "go"
+		if filepath.Ext(path) == ".mustache" {
+			engine = "mustache"
+		}
+		if err := RenderCfg(path, engine, rendered); err != nil {
+			t.Errorf("Expected no error for %s, got: %s", path, err)
+			continue
+		}
+		if rendered.String() != expected {
+			t.Errorf("Expected %q for %s, got: %q", expected, path, rendered.String())
+		}
+	}
+	// templates without missing variables render as usual
+	var rendered = new(bytes.Buffer)
+	if err := RenderCfg(tplPathGo, "go", rendered); err != nil {
+		t.Error(err)
+	}
+	if rendered.String() != "test=test\n" {
+		t.Error("Expected \"test=test\", got: ", rendered.String())
+	}
+}
+
+func TestRenderCfgGoEngineFuncs(t *testing.T) {
+	os.Setenv("test_func_hosts", "a, b,c")
+	defer os.Unsetenv("test_func_hosts")
+	envInstance = nil
+	defer func() { envInstance = nil }()
+	var rendered = new(bytes.Buffer)
+	if err := RenderCfg("test/funcs.redacted", "go", rendered); err != nil {
+		t.Fatal(err)
+	}
+	expected := `fallback
+["A"]["B"]["C"]
+a;b;c
+YSwgYixj a, b,c
+["a","b","c"]
+
+  - a
+  - b
+  - c
+a  b 
+'it''s'
+`
+	if rendered.String() != expected {
+		t.Errorf("Expected %q, got: %q", expected, rendered.String())
+	}
+}
+
+func TestRenderCfgCoerce(t *testing.T) {
+	vars := map[string]string{
+		"test_typed_flag": "false",
+		"test_typed_list": "a, b",
+		"test_typed_obj":  `{"name": "obj"}`,
+		"test_typed_mode": "0644",
+	}
+	for k, v := range vars {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	envInstance = nil
+	defer func() { envInstance = nil }()
+	TplOptions.Coerce = true
+	TplOptions.Types = map[string]string{"test_typed_list": "list"}
+	defer func() { TplOptions.Coerce, TplOptions.Types = false, nil }()
+	for path, engine := range map[string]string{"test/typed.redacted": "go", "test/typed.mustache": "mustache"} {
+		var rendered = new(bytes.Buffer)
+		if err := RenderCfg(path, engine, rendered); err != nil {
+			t.Error(err)
+			continue
+		}
+		if rendered.String() != "off [a][b] obj 0644\n" {
+			t.Errorf("Expected \"off [a][b] obj 0644\" for %s, got: %q", path, rendered.String())
+		}
+	}
+	// values that don't render exactly as written remain strings
+	for _, val := range []string{"TRUE", "+5", "-0", "1.0"} {
+		os.Setenv("test_typed_mode", val)
+		envInstance = nil
+		var rendered = new(bytes.Buffer)
+		if err := RenderCfg("test/typed.redacted", "go", rendered); err != nil {
+			t.Error(err)
+			continue
+		}
+		if expected := "off [a][b] obj " + val + "\n"; rendered.String() != expected {
+			t.Errorf("Expected %q, got: %q", expected, rendered.String())
+		}
+	}
+	// invalid declared types fail rendering
+	TplOptions.Types = map[string]string{"test_typed_list": "int"}
+	if err := RenderCfg("test/typed.redacted", "go", new(bytes.Buffer)); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestRenderCfgNestDelim(t *testing.T) {
+	vars := map[string]string{
+		"test__nest__name": "es",
+		"test__nest__port": "9200",
+		"test__":           "ignored",
+	}
+	for k, v := range vars {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	envInstance = nil
+	defer func() { envInstance = nil }()
+	TplOptions.NestDelim = "__"
+	TplOptions.Strict = true
+	defer func() { TplOptions.NestDelim, TplOptions.Strict = "", false }()
+	expected := map[string]string{
+		"test/nested.redacted": "es:[name=es][port=9200]:es\n",
+		"test/nested.mustache": "es:9200:es\n",
+	}
+	for path, engine := range map[string]string{"test/nested.redacted": "go", "test/nested.mustache": "mustache"} {
+		var rendered = new(bytes.Buffer)
+		if err := RenderCfg(path, engine, rendered); err != nil {
+			t.Error(err)
+			continue
+		}
+		if rendered.String() != expected[path] {
+			t.Errorf("Expected %q for %s, got: %q", expected[path], path, rendered.String())
+		}
+	}
+}
+
+func TestRenderCfgFileFuncs(t *testing.T) {
+	// file functions fail without file roots
+	if err := RenderCfg("test/files.redacted", "go", new(bytes.Buffer)); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	TplOptions.FileRoots = []string{"test/files"}
+	defer func() { TplOptions.FileRoots = nil }()
+	var rendered = new(bytes.Buffer)
+	if err := RenderCfg("test/files.redacted", "go", rendered); err != nil {
+		t.Fatal(err)
+	}
+	expected := "CERT\ntrue false\n[test/files/a.conf][test/files/b.conf]\na.conf,b.conf,ca.pem\n"
+	if rendered.String() != expected {
+		t.Errorf("Expected %q, got: %q", expected, rendered.String())
+	}
+	// paths outside of file roots are denied
+	TplOptions.FileRoots = []string{"test/files/sub", "test/file"}
+	if err := RenderCfg("test/files.redacted", "go", new(bytes.Buffer)); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestRenderCfgSystemFuncs(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(root, meminfo string) { template.CgroupRoot, template.MeminfoPath = root, meminfo }(template.CgroupRoot, template.MeminfoPath)
+	template.MeminfoPath = "test/meminfo"
+	expected := map[string]string{
+		// 1 cpu quota and no memory limit
+		"test/cgroup-v1": hostname + " 1 2147483648\n127.0.0.1 127.0.0.1\n",
+		// 0.5 cpu quota and 512MiB memory limit
+		"test/cgroup-v2": hostname + " 1 536870912\n127.0.0.1 127.0.0.1\n",
+	}
+	for root, out := range expected {
+		template.CgroupRoot = root
+		var rendered = new(bytes.Buffer)
+		if err = RenderCfg("test/system.redacted", "go", rendered); err != nil {
+			t.Error(err)
+			continue
+		}
+		if rendered.String() != out {
+			t.Errorf("Expected %q for %s, got: %q", out, root, rendered.String())
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package redact
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// variable source types
+const (
+	SourceEnv    = "env"
+	SourceDotEnv = "dotenv"
+	SourceFile   = "file"
+	SourceDir    = "dir"
+	SourceStdin  = "stdin"
+	SourceVault  = "vault"
+	SourceConsul = "consul"
+)
+
+// Source represents a source of template variables
+type Source interface {
+	Load() (map[string]string, error)
+}
+
+// EnvSource loads variables from the process environment
+type EnvSource struct{}
+
+// Load implements the Source interface
+func (s *EnvSource) Load() (map[string]string, error) {
+	return environToMap(os.Environ()), nil
+}
+
+// DotEnvSource loads variables from a .env file of KEY=VALUE lines
+type DotEnvSource struct {
+	Path string
+}
+
+// Load implements the Source interface
+func (s *DotEnvSource) Load() (map[string]string, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vars, err := parseDotEnv(f)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(s.Path, ": ", err))
+	}
+	return vars, nil
+}
+
+// FileSource loads variables from the top level keys of a JSON or YAML file
+// where nested values are JSON encoded
+type FileSource struct {
+	Path string
+}
+
+// Load implements the Source interface
+func (s *FileSource) Load() (map[string]string, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var vars map[string]string
+	switch strings.ToLower(filepath.Ext(s.Path)) {
+	case ".json":
+		vars, err = parseJSONVars(data)
+	case ".yaml", ".yml":
+		vars, err = parseYAMLVars(data)
+	default:
+		return nil, errors.New(s.Path + ": unsupported variable file extension (expected .json, .yaml or .yml)")
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(s.Path, ": ", err))
+	}
+	return vars, nil
+}
+
+// DirSource loads variables from a directory of files (i.e. a Kubernetes
+// ConfigMap or Secret volume) where each file name is a variable name and the
+// file contents, with trailing newlines trimmed, is its value. Hidden files
+// and directories are skipped.
+type DirSource struct {
+	Path string
+}
+
+// Load implements the Source interface
+func (s *DirSource) Load() (map[string]string, error) {
+	infos, err := ioutil.ReadDir(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(s.Path, info.Name())
+		// follow symlinks since mounted volume files link to a data directory
+		if info, err = os.Stat(path); err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if vars[info.Name()], err = readFileVar(path); err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+// StdinSource loads variables from a reader (stdin by default) in .env format
+type StdinSource struct {
+	Reader io.Reader
+}
+
+// Load implements the Source interface
+func (s *StdinSource) Load() (map[string]string, error) {
+	var r = s.Reader
+	if r == nil {
+		r = os.Stdin
+	}
+	vars, err := parseDotEnv(r)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("stdin: ", err))
+	}
+	return vars, nil
+}
+
+// ParseSource parses a variable source from a string in the form TYPE[:PATH]
+// i.e. "env", "dotenv:/app/.env", "file:/app/vars.yaml", "dir:/etc/secrets",
+// "stdin", "vault:secret/myapp" or "consul:myapp". A consul source
+// without a prefix loads every key.
+func ParseSource(s string) (Source, error) {
+	pair := strings.SplitN(s, ":", 2)
+	var typ, path = pair[0], ""
+	if len(pair) == 2 {
+		path = pair[1]
+	}
+	var requiresPath = typ == SourceDotEnv || typ == SourceFile || typ == SourceDir || typ == SourceVault
+	if requiresPath && len(path) == 0 {
+		return nil, errors.New("invalid variable source (expected " + typ + ":PATH): " + s)
+	}
+	if (typ == SourceEnv || typ == SourceStdin) && len(path) != 0 {
+		return nil, errors.New("invalid variable source (" + typ + " takes no path): " + s)
+	}
+	switch typ {
+	case SourceEnv:
+		return new(EnvSource), nil
+	case SourceStdin:
+		return new(StdinSource), nil
+	case SourceDotEnv:
+		return &DotEnvSource{Path: path}, nil
+	case SourceFile:
+		return &FileSource{Path: path}, nil
+	case SourceDir:
+		return &DirSource{Path: path}, nil
+	case SourceVault:
+		source, err := NewVaultSource(path, GetEnvInstance())
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	case SourceConsul:
+		return NewConsulSource(path, GetEnvInstance()), nil
+	default:
+		return nil, errors.New("invalid variable source type: " + typ)
+	}
+}
+
+// LoadSources loads and merges the variables of every source in order where
+// variables from later sources take precedence
+func LoadSources(sources []Source) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, source := range sources {
+		loaded, err := source.Load()
+		if err != nil {
+			return nil, err
+		}
+		for name, val := range loaded {
+			vars[name] = val
+		}
+	}
+	return vars, nil
+}
+
+// parseDotEnv parses KEY=VALUE lines where blank lines and lines starting with
+// "#" are ignored, an "export " prefix is allowed and values may be single
+// quoted (literal) or double quoted (with \n, \" and \\ escapes)
+func parseDotEnv(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	// allow values as large as file vars with room for the key
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), int(FileVarMaxSize)+bufio.MaxScanTokenSize)
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		pair := strings.SplitN(line, "=", 2)
+		name := strings.TrimSpace(pair[0])
+		if len(pair) != 2 || len(name) == 0 {
+			return nil, errors.New(fmt.Sprintf("line %d: expected KEY=VALUE", n))
+		}
+		val := strings.TrimSpace(pair[1])
+		switch {
+		case len(val) > 1 && val[0] == '\'' && val[len(val)-1] == '\'':
+			val = val[1 : len(val)-1]
+		case len(val) > 1 && val[0] == '"' && val[len(val)-1] == '"':
+			val = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(val[1 : len(val)-1])
+		default:
+			if i := strings.Index(val, " #"); i != -1 {
+				val = strings.TrimSpace(val[:i])
+			}
+		}
+		vars[name] = val
+	}
+	if err := scanner.Err(); err == bufio.ErrTooLong {
+		return nil, errors.New(fmt.Sprintf("line %d: line too long", n+1))
+	} else if err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// parseJSONVars parses the top level keys of a JSON object as variables
+func parseJSONVars(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return stringifyVars(obj)
+}
+
+// parseYAMLVars parses the top level keys of a YAML mapping as variables
+func parseYAMLVars(data []byte) (map[string]string, error) {
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return stringifyVars(obj)
+}
+
+// stringifyVars returns the string values of `obj` where nested values are
+// JSON encoded so they can be coerced back to typed values
+func stringifyVars(obj map[string]interface{}) (map[string]string, error) {
+	vars := make(map[string]string, len(obj))
+	for name, v := range obj {
+		switch val := v.(type) {
+		case string:
+			vars[name] = val
+		case nil:
+			vars[name] = ""
+		case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+			b, err := json.Marshal(jsonCompatible(val))
+			if err != nil {
+				return nil, errors.New(fmt.Sprint(name, ": ", err))
+			}
+			vars[name] = string(b)
+		default:
+			vars[name] = fmt.Sprint(val)
+		}
+	}
+	return vars, nil
+}
+
+// jsonCompatible converts YAML decoded maps with interface keys to maps with
+// string keys so they can be JSON encoded
+func jsonCompatible(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, elem := range val {
+			m[fmt.Sprint(k)] = jsonCompatible(elem)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, elem := range val {
+			m[k] = jsonCompatible(elem)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, elem := range val {
+			list[i] = jsonCompatible(elem)
+		}
+		return list
+	}
+	return v
+}
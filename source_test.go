@@ -0,0 +1,116 @@
+package redact
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSources(t *testing.T) {
+	expected := map[string]map[string]string{
+		"dotenv:test/source.env": {
+			"APP_NAME":     "app",
+			"APP_PORT":     "8080",
+			"APP_GREETING": "hello\nworld",
+			"APP_LITERAL":  `$HOME\n`,
+		},
+		"file:test/source.yaml": {
+			"app_name":  "app",
+			"app_port":  "8080",
+			"app_hosts": `["a","b"]`,
+			"app_db":    `{"host":"db"}`,
+		},
+		"file:test/source.json": {
+			"app_name":  "app",
+			"app_port":  "8080",
+			"app_ratio": "1.50",
+			"app_tls":   `{"enabled":true}`,
+		},
+		"dir:test/source-dir": {
+			"db_host":     "db",
+			"db_password": "s3cret",
+		},
+	}
+	for spec, vars := range expected {
+		source, err := ParseSource(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := source.Load()
+		if err != nil {
+			t.Error(spec, ": ", err)
+			continue
+		}
+		if len(loaded) != len(vars) {
+			t.Error(spec, ": expected ", len(vars), " vars, got: ", loaded)
+		}
+		for name, val := range vars {
+			if loaded[name] != val {
+				t.Errorf("%s: expected %s to be %q, got: %q", spec, name, val, loaded[name])
+			}
+		}
+	}
+	// stdin
+	loaded, err := (&StdinSource{Reader: bytes.NewBufferString("A=1\nB='2'\n")}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded["A"] != "1" || loaded["B"] != "2" {
+		t.Error("Expected A=1 and B=2, got: ", loaded)
+	}
+	if _, err = (&StdinSource{Reader: bytes.NewBufferString("invalid\n")}).Load(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+	// lines longer than the default scanner buffer
+	long := strings.Repeat("a", 128*1024)
+	loaded, err = (&StdinSource{Reader: bytes.NewBufferString("A=" + long + "\n")}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded["A"] != long {
+		t.Error("Expected A to be 128KiB, got: ", len(loaded["A"]))
+	}
+	long = strings.Repeat("a", int(FileVarMaxSize)+bufio.MaxScanTokenSize)
+	if _, err = (&StdinSource{Reader: bytes.NewBufferString("A=" + long + "\n")}).Load(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	for _, spec := range []string{"env", "stdin", "dotenv:.env", "file:vars.yaml", "dir:/etc/secrets"} {
+		if _, err := ParseSource(spec); err != nil {
+			t.Error(spec, ": ", err)
+		}
+	}
+	for _, spec := range []string{"", "env:/path", "dotenv", "dir:", "vault", "unknown:/path"} {
+		if _, err := ParseSource(spec); err == nil {
+			t.Error(spec, ": expected err to be error, got: nil")
+		}
+	}
+}
+
+func TestLoadSources(t *testing.T) {
+	os.Setenv("APP_PORT", "9090")
+	defer os.Unsetenv("APP_PORT")
+	env, _ := ParseSource("env")
+	dotenv, _ := ParseSource("dotenv:test/source.env")
+	vars, err := LoadSources([]Source{env, dotenv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["APP_PORT"] != "8080" {
+		t.Error("Expected APP_PORT to be 8080, got: ", vars["APP_PORT"])
+	}
+	vars, err = LoadSources([]Source{dotenv, env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["APP_PORT"] != "9090" {
+		t.Error("Expected APP_PORT to be 9090, got: ", vars["APP_PORT"])
+	}
+	if _, err = LoadSources([]Source{&DotEnvSource{Path: "test/missing.env"}}); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
@@ -0,0 +1,253 @@
+package redact
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Supervisor runs a command as a child process with the credentials of a user
+// spec so redact can stay resident (i.e. to re-render config on change). Like
+// tini or dumb-init, it waits on the child itself on SIGCHLD and, with
+// `ReapZombies`, also reaps every other exited child i.e. orphans re-parented
+// to redact running as PID 1.
+type Supervisor struct {
+	UserSpec    string
+	Args        []string
+	ReapZombies bool
+	mu          sync.Mutex
+	cmd         *exec.Cmd
+	reaper      sync.Once
+	reapMu      sync.Mutex         // guards pid, done and status
+	pid         int                // pid of the running child or 0 once reaped
+	done        chan struct{}      // closed when the child exits
+	status      syscall.WaitStatus // wait status of the exited child
+}
+
+// NewSupervisor creates a supervisor for the command `args` run as the user
+// spec `userSpec` that reaps zombies when redact is PID 1
+func NewSupervisor(userSpec string, args []string) *Supervisor {
+	return &Supervisor{UserSpec: userSpec, Args: args, ReapZombies: os.Getpid() == 1}
+}
+
+// Start starts the child process
+func (s *Supervisor) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start()
+}
+
+// start starts the child process as the user spec (callers must hold the lock)
+func (s *Supervisor) start() error {
+	if len(s.Args) == 0 {
+		return errors.New("no command specified")
+	}
+	execUser, err := lookupUser(s.UserSpec)
+	if err != nil {
+		return err
+	}
+	var groups = make([]uint32, len(execUser.Sgids))
+	for i, gid := range execUser.Sgids {
+		groups[i] = uint32(gid)
+	}
+	cmd := exec.Command(s.Args[0], s.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// the same as gosu, HOME is set to the home of the user spec
+	cmd.Env = append(os.Environ(), "HOME="+execUser.Home)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:    uint32(execUser.Uid),
+			Gid:    uint32(execUser.Gid),
+			Groups: groups,
+		},
+	}
+	// SIGCHLD must be handled before the child can exit
+	s.reaper.Do(func() {
+		var sigchld = make(chan os.Signal, 1)
+		signal.Notify(sigchld, syscall.SIGCHLD)
+		go func() {
+			for range sigchld {
+				s.reap()
+			}
+		}()
+	})
+	// the child can't be reaped before its pid is known
+	s.reapMu.Lock()
+	defer s.reapMu.Unlock()
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	s.cmd = cmd
+	s.pid, s.done, s.status = cmd.Process.Pid, make(chan struct{}), 0
+	return nil
+}
+
+// reap waits on every exited child without blocking, or only the supervised
+// child without `ReapZombies`, and closes done once the supervised child exits.
+// Nothing is reaped once it has exited as redact is about to exit or restart it.
+func (s *Supervisor) reap() {
+	s.reapMu.Lock()
+	defer s.reapMu.Unlock()
+	for s.pid != 0 {
+		var pid = s.pid
+		if s.ReapZombies {
+			pid = -1
+		}
+		var status syscall.WaitStatus
+		wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || wpid <= 0 {
+			return
+		}
+		if wpid == s.pid {
+			s.pid, s.status = 0, status
+			s.cmd.Process.Release()
+			close(s.done)
+		}
+	}
+}
+
+// WithoutReaping runs `f` while no children are reaped so any child processes
+// `f` runs (i.e. pre-render scripts) can be waited on by `f`
+func (s *Supervisor) WithoutReaping(f func()) {
+	s.reapMu.Lock()
+	defer s.reapMu.Unlock()
+	f()
+}
+
+// Signal sends `sig` to the child process
+func (s *Supervisor) Signal(sig os.Signal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signal(sig)
+}
+
+// signal sends `sig` to the child process if it hasn't been reaped so its pid
+// can't have been reused (callers must hold the lock)
+func (s *Supervisor) signal(sig os.Signal) error {
+	if s.cmd == nil {
+		return errors.New("child process not started")
+	}
+	s.reapMu.Lock()
+	defer s.reapMu.Unlock()
+	if s.pid == 0 {
+		return errors.New("child process already exited")
+	}
+	return s.cmd.Process.Signal(sig)
+}
+
+// Forward sends `sig` to the child process unless it is SIGCHLD, which is
+// handled by the supervisor, or SIGURG, which is used by the go runtime
+func (s *Supervisor) Forward(sig os.Signal) error {
+	if sig == syscall.SIGCHLD || sig == syscall.SIGURG {
+		return nil
+	}
+	return s.Signal(sig)
+}
+
+// Restart stops the child process with SIGTERM, or SIGKILL if it hasn't
+// exited after `timeout`, then starts it again. The child can still be
+// signaled while waiting for it to exit and it isn't started again if it was
+// already restarted in the meantime.
+func (s *Supervisor) Restart(timeout time.Duration) error {
+	s.mu.Lock()
+	if s.cmd == nil {
+		defer s.mu.Unlock()
+		return s.start()
+	}
+	var done = s.getDone()
+	s.signal(syscall.SIGTERM)
+	s.mu.Unlock()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.Signal(syscall.SIGKILL)
+		<-done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.getDone() != done {
+		return nil
+	}
+	return s.start()
+}
+
+// Run starts the child process, forwards every signal received to it until
+// it exits and returns its exit code
+func (s *Supervisor) Run() (int, error) {
+	var signals = make(chan os.Signal, 32)
+	signal.Notify(signals)
+	defer signal.Stop(signals)
+	if err := s.Start(); err != nil {
+		return 0, err
+	}
+	var done = s.Done()
+	for {
+		select {
+		case <-done:
+			return s.ExitCode(), nil
+		case sig := <-signals:
+			s.Forward(sig)
+		}
+	}
+}
+
+// Done returns a channel that is closed when the current child process exits
+func (s *Supervisor) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getDone()
+}
+
+// getDone returns the done channel of the current child process
+func (s *Supervisor) getDone() chan struct{} {
+	s.reapMu.Lock()
+	defer s.reapMu.Unlock()
+	return s.done
+}
+
+// ExitCode returns the exit code of the exited child process where a child
+// killed by a signal exits with 128 + the signal number like a shell
+func (s *Supervisor) ExitCode() int {
+	s.reapMu.Lock()
+	defer s.reapMu.Unlock()
+	if s.status.Signaled() {
+		return 128 + int(s.status.Signal())
+	}
+	return s.status.ExitStatus()
+}
+
+// ParseSignal parses a signal name (i.e. "SIGHUP" or "HUP") or number
+func ParseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 && n < 65 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signalsByName[s]; ok {
+		return sig, nil
+	}
+	if sig, ok := signalsByName["SIG"+s]; ok {
+		return sig, nil
+	}
+	return 0, errors.New("invalid signal: " + s)
+}
+
+// signals that may be sent to the child process by name
+var signalsByName = map[string]syscall.Signal{
+	"SIGHUP":   syscall.SIGHUP,
+	"SIGINT":   syscall.SIGINT,
+	"SIGQUIT":  syscall.SIGQUIT,
+	"SIGKILL":  syscall.SIGKILL,
+	"SIGUSR1":  syscall.SIGUSR1,
+	"SIGUSR2":  syscall.SIGUSR2,
+	"SIGTERM":  syscall.SIGTERM,
+	"SIGCONT":  syscall.SIGCONT,
+	"SIGSTOP":  syscall.SIGSTOP,
+	"SIGWINCH": syscall.SIGWINCH,
+}
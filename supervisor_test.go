@@ -0,0 +1,131 @@
+package redact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSupervisor(t *testing.T) {
+	var userSpec = strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	s := NewSupervisor(userSpec, []string{"sh", "-c", "exit 3"})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-s.Done()
+	if code := s.ExitCode(); code != 3 {
+		t.Error("Expected exit code 3, got: ", code)
+	}
+	// signaled and restarted child
+	s = NewSupervisor(userSpec, []string{"sleep", "60"})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var done = s.Done()
+	if err := s.Restart(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if err := s.Signal(syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	<-s.Done()
+	if code := s.ExitCode(); code != 128+int(syscall.SIGKILL) {
+		t.Error("Expected exit code 137, got: ", code)
+	}
+	// the child can be signaled while restart waits for it to exit
+	s = NewSupervisor(userSpec, []string{"sh", "-c", "trap '' TERM; exec sleep 60"})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var restarted = make(chan error)
+	go func() { restarted <- s.Restart(30 * time.Second) }()
+	time.Sleep(200 * time.Millisecond)
+	if err := s.Signal(syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-restarted:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected restart to return after the child was killed")
+	}
+	s.Signal(syscall.SIGKILL)
+	<-s.Done()
+	if err := NewSupervisor(userSpec, nil).Start(); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
+
+func TestSupervisorRun(t *testing.T) {
+	var userSpec = strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	s := NewSupervisor(userSpec, []string{"sh", "-c", "trap 'exit 7' USR1; while true; do sleep 0.05; done"})
+	go func() {
+		// signals received by the supervisor are forwarded to the child
+		time.Sleep(500 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	}()
+	code, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 7 {
+		t.Error("Expected exit code 7, got: ", code)
+	}
+}
+
+func TestSupervisorReapZombies(t *testing.T) {
+	// orphans are re-parented to a child subreaper like they are to PID 1
+	const prSetChildSubreaper = 36
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+		t.Skip("child subreaper not supported: ", errno)
+	}
+	defer syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 0, 0)
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var pidPath = filepath.Join(dir, "pid")
+	var userSpec = strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	// the subshell exits leaving sleep orphaned while the child is running
+	s := NewSupervisor(userSpec, []string{"sh", "-c", "(sleep 0.1 & echo $! > " + pidPath + "); sleep 2"})
+	s.ReapZombies = true
+	if err = s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Signal(syscall.SIGKILL)
+	var procPath string
+	for i := 0; i < 50; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if len(procPath) == 0 {
+			data, err := ioutil.ReadFile(pidPath)
+			if err != nil || len(strings.TrimSpace(string(data))) == 0 {
+				continue
+			}
+			procPath = filepath.Join("/proc", strings.TrimSpace(string(data)))
+		}
+		if _, err = os.Stat(procPath); os.IsNotExist(err) {
+			return
+		}
+	}
+	t.Error("Expected orphan ", procPath, " to be reaped")
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, s := range []string{"SIGHUP", "HUP", "1"} {
+		if sig, err := ParseSignal(s); err != nil || sig != syscall.SIGHUP {
+			t.Error("Expected SIGHUP for ", s, ", got: ", sig, err)
+		}
+	}
+	if _, err := ParseSignal("SIGFOO"); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
@@ -0,0 +1,105 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// variable type names for declared variable types
+const (
+	VarTypeString = "string"
+	VarTypeBool   = "bool"
+	VarTypeInt    = "int"
+	VarTypeFloat  = "float"
+	VarTypeList   = "list"
+	VarTypeJSON   = "json"
+)
+
+// Coerce interprets a variable value by convention: "true" and "false" are
+// booleans, base 10 integers are ints and valid JSON arrays and objects are
+// lists and maps. Scalars are only coerced when they render exactly as written
+// (i.e. not "TRUE", "+5" or "0644"). Everything else remains a string.
+func Coerce(s string) interface{} {
+	if b, err := strconv.ParseBool(s); err == nil && strconv.FormatBool(b) == s {
+		return b
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(i, 10) == s {
+		return i
+	}
+	if trimmed := strings.TrimSpace(s); strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		if v, err := decodeJSON(trimmed); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// CoerceType interprets a variable value as the declared type `typ` where a
+// list is a comma separated string or a JSON array
+func CoerceType(s, typ string) (interface{}, error) {
+	switch typ {
+	case VarTypeString:
+		return s, nil
+	case VarTypeBool:
+		return strconv.ParseBool(s)
+	case VarTypeInt:
+		return strconv.ParseInt(s, 10, 64)
+	case VarTypeFloat:
+		return strconv.ParseFloat(s, 64)
+	case VarTypeList:
+		if trimmed := strings.TrimSpace(s); strings.HasPrefix(trimmed, "[") {
+			v, err := decodeJSON(trimmed)
+			if _, ok := v.([]interface{}); err != nil || !ok {
+				return nil, errors.New("invalid JSON list: " + s)
+			}
+			return v, nil
+		}
+		var list = []interface{}{}
+		for _, elem := range split(",", s) {
+			list = append(list, elem)
+		}
+		return list, nil
+	case VarTypeJSON:
+		return decodeJSON(s)
+	default:
+		return nil, errors.New("invalid variable type: " + typ)
+	}
+}
+
+// coerceVars returns `vars` with each value coerced by its declared type in
+// `types` or by convention when `convention` is true
+func coerceVars(vars map[string]string, types map[string]string, convention bool) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(vars))
+	for name, val := range vars {
+		if typ, ok := types[name]; ok {
+			v, err := CoerceType(val, typ)
+			if err != nil {
+				return nil, errors.New(name + ": " + err.Error())
+			}
+			data[name] = v
+		} else if convention {
+			data[name] = Coerce(val)
+		} else {
+			data[name] = val
+		}
+	}
+	return data, nil
+}
+
+// decodeJSON decodes a JSON value keeping numbers as json.Number so they
+// render exactly as written
+func decodeJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewBufferString(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("invalid JSON: trailing data")
+	}
+	return v, nil
+}
@@ -17,6 +17,7 @@ const (
 // Engine template engine interface
 type Engine interface {
 	Render(tpl *Template, w io.Writer) error
+	Refs(tpl *Template) ([]VarRef, error)
 }
 
 // EngineFactory returns an engine ptr based on the string name of the engine
@@ -38,21 +39,58 @@ type GoEngine struct {
 // Render implements the Engine interface and renders template data
 // from the io.Reader stream to the io.Writer stream
 func (g *GoEngine) Render(tpl *Template, w io.Writer) error {
-	tplData, err := tpl.ReadAllToString()
+	t, tplData, err := g.parse(tpl)
 	if err != nil {
 		return err
 	}
-	t, err := template.New("").Parse(tplData)
+	data, err := tpl.Data()
 	if err != nil {
 		return err
 	}
-	err = t.Execute(w, tpl.Vars())
+	if tpl.Options().Strict {
+		refs := goRefs(t, tplData)
+		if err = checkMissingVars(refs, data); err != nil {
+			return err
+		}
+		// missing optional variables (i.e. conditions or piped to `default`)
+		// are set empty since any other missing key is an execution error
+		data = fillMissingVars(data, refs)
+	}
+	err = t.Execute(w, data)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// Refs implements the Engine interface and returns the variables referenced
+// by the template
+func (g *GoEngine) Refs(tpl *Template) ([]VarRef, error) {
+	t, tplData, err := g.parse(tpl)
+	if err != nil {
+		return nil, err
+	}
+	return goRefs(t, tplData), nil
+}
+
+// parse reads and parses the template data
+func (g *GoEngine) parse(tpl *Template) (*template.Template, string, error) {
+	tplData, err := tpl.ReadAllToString()
+	if err != nil {
+		return nil, "", err
+	}
+	t := template.New(tpl.Path()).Funcs(funcMap(tpl))
+	if tpl.Options().Strict {
+		// backstop for references not checked before rendering
+		t.Option("missingkey=error")
+	}
+	t, err = t.Parse(tplData)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, tplData, nil
+}
+
 // MustacheEngine mustache template engine
 type MustacheEngine struct {
 }
@@ -64,7 +102,20 @@ func (m *MustacheEngine) Render(tpl *Template, w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	r, err := mustache.Render(tplData, tpl.Vars())
+	data, err := tpl.Data()
+	if err != nil {
+		return err
+	}
+	if tpl.Options().Strict {
+		refs, err := mustacheRefs(tplData)
+		if err != nil {
+			return err
+		}
+		if err = checkMissingVars(refs, data); err != nil {
+			return err
+		}
+	}
+	r, err := mustache.Render(tplData, data)
 	if err != nil {
 		return err
 	}
@@ -74,3 +125,13 @@ func (m *MustacheEngine) Render(tpl *Template, w io.Writer) error {
 	}
 	return nil
 }
+
+// Refs implements the Engine interface and returns the variables referenced
+// by the template
+func (m *MustacheEngine) Refs(tpl *Template) ([]VarRef, error) {
+	tplData, err := tpl.ReadAllToString()
+	if err != nil {
+		return nil, err
+	}
+	return mustacheRefs(tplData)
+}
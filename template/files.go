@@ -0,0 +1,124 @@
+package template
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileFuncs provides the file template functions which may only access paths
+// within the template's file roots
+type fileFuncs struct {
+	roots []string
+}
+
+// readFile returns the contents of the file at `path`
+func (f *fileFuncs) readFile(path string) (string, error) {
+	resolved, err := f.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// fileExists reports whether a file or directory exists at `path`
+func (f *fileFuncs) fileExists(path string) (bool, error) {
+	resolved, err := f.resolve(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(resolved)
+	return err == nil, nil
+}
+
+// glob returns the sorted paths matching `pattern` where matches outside of
+// the file roots (i.e. via symlinks) are omitted
+func (f *fileFuncs) glob(pattern string) ([]string, error) {
+	if _, err := f.within(filepath.Dir(pattern)); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var paths = []string{}
+	for _, match := range matches {
+		if _, err = f.resolve(match); err == nil {
+			paths = append(paths, match)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// readDir returns the sorted names of the entries of the directory at `path`
+func (f *fileFuncs) readDir(path string) ([]string, error) {
+	resolved, err := f.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(resolved)
+	if err != nil {
+		return nil, err
+	}
+	var names = []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, nil
+}
+
+// resolve returns the absolute path of `path` with symlinks evaluated or an
+// error if it doesn't exist or is not within a file root
+func (f *fileFuncs) resolve(path string) (string, error) {
+	abs, err := f.within(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	return f.within(resolved)
+}
+
+// within returns the clean absolute path of `path` or an error if it is not
+// within a file root
+func (f *fileFuncs) within(path string) (string, error) {
+	if len(f.roots) == 0 {
+		return "", errors.New("file access denied: no file roots configured")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range f.roots {
+		if root, err = filepath.Abs(root); err != nil {
+			continue
+		}
+		// roots may themselves be symlinks i.e. mounted volume data dirs
+		if resolved, err := filepath.EvalSymlinks(root); err == nil && hasPathPrefix(abs, resolved) {
+			return abs, nil
+		}
+		if hasPathPrefix(abs, root) {
+			return abs, nil
+		}
+	}
+	return "", errors.New("file access denied: " + path + " is not within a file root")
+}
+
+// hasPathPrefix reports whether `path` is `root` or within `root` where both
+// are clean absolute paths
+func hasPathPrefix(path, root string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
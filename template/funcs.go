@@ -0,0 +1,169 @@
+package template
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// funcMap returns the built-in function library available to go templates.
+// Functions taking the value to operate on do so as their last param so they
+// can be used at the end of a pipeline i.e. {{.hosts | split ","}}
+func funcMap(tpl *Template) template.FuncMap {
+	files := &fileFuncs{roots: tpl.opts.FileRoots}
+	return template.FuncMap{
+		// defaults and validation
+		"default":  defaultVal,
+		"required": required,
+		"empty":    empty,
+		"env":      func(name string) string { return tpl.vars[name] },
+		// strings
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"replace":    func(old, repl, s string) string { return strings.Replace(s, old, repl, -1) },
+		"quote":      func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+		"squote":     squote,
+		"indent":     indent,
+		"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+		// lists
+		"split": split,
+		"join":  join,
+		"list":  func(v ...interface{}) []interface{} { return v },
+		// encoding
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": b64dec,
+		"toJson": toJSON,
+		"toYaml": toYAML,
+		// files (restricted to file roots)
+		"readFile":   files.readFile,
+		"fileExists": files.fileExists,
+		"glob":       files.glob,
+		"readDir":    files.readDir,
+		// system and network
+		"hostname":    os.Hostname,
+		"interfaceIP": interfaceIP,
+		"lookupHost":  lookupHost,
+		"lookupSRV":   lookupSRV,
+		"cpuCount":    cpuCount,
+		"memLimit":    memLimit,
+	}
+}
+
+// defaultVal returns `val` unless empty in which case `def` is returned
+func defaultVal(def, val interface{}) interface{} {
+	if empty(val) {
+		return def
+	}
+	return val
+}
+
+// squote returns `v` single quoted with each embedded single quote doubled as
+// in YAML and SQL
+func squote(v interface{}) string {
+	return "'" + strings.Replace(fmt.Sprint(v), "'", "''", -1) + "'"
+}
+
+// required returns `val` or an error with message `msg` if `val` is empty
+func required(msg string, val interface{}) (interface{}, error) {
+	if empty(val) {
+		return nil, errors.New(msg)
+	}
+	return val, nil
+}
+
+// empty reports whether `val` is nil or the zero value of its type where empty
+// slices and maps are also considered empty
+func empty(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// indent indents every line of `s` with `n` spaces
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// split splits `s` on `sep` trimming surrounding whitespace from each element
+// where an empty string results in an empty list
+func split(sep, s string) []string {
+	if len(strings.TrimSpace(s)) == 0 {
+		return []string{}
+	}
+	list := strings.Split(s, sep)
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	return list
+}
+
+// join joins the elements of a list with `sep`
+func join(sep string, list interface{}) (string, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", errors.New(fmt.Sprintf("join: expected list, got %T", list))
+	}
+	elems := make([]string, v.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(elems, sep), nil
+}
+
+// b64dec decodes a standard base64 encoded string
+func b64dec(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// toJSON encodes `v` as JSON which also produces valid escaped JSON strings
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// toYAML encodes `v` as YAML without the trailing newline
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
@@ -0,0 +1,68 @@
+package template
+
+import (
+	"sort"
+	"strings"
+)
+
+// namespace is a nested map of vars created from delimited var names which is
+// distinct from map values decoded from JSON vars
+type namespace map[string]interface{}
+
+// nestVars adds nested maps to `data` for every var name containing `delim`
+// i.e. with a "__" delim, "es__cluster__name" is also available as
+// data["es"]["cluster"]["name"]. The flat vars are always kept and names that
+// conflict with an existing var or value are not nested.
+func nestVars(data map[string]interface{}, delim string) {
+	var names []string
+	for name := range data {
+		if strings.Contains(name, delim) {
+			names = append(names, name)
+		}
+	}
+	// sort for deterministic conflict resolution
+	sort.Strings(names)
+	for _, name := range names {
+		path := strings.Split(name, delim)
+		if hasEmptySegment(path) {
+			continue
+		}
+		setNested(data, path, data[name])
+	}
+}
+
+// setNested sets `val` at `path` in `m` creating nested maps as required and
+// reports whether the value was set without conflict
+func setNested(m map[string]interface{}, path []string, val interface{}) bool {
+	if len(path) == 1 {
+		if _, ok := m[path[0]]; ok {
+			return false
+		}
+		m[path[0]] = val
+		return true
+	}
+	child, ok := m[path[0]]
+	if !ok {
+		nested := make(namespace)
+		if !setNested(nested, path[1:], val) {
+			return false
+		}
+		m[path[0]] = nested
+		return true
+	}
+	nested, ok := child.(namespace)
+	if !ok {
+		return false
+	}
+	return setNested(nested, path[1:], val)
+}
+
+// hasEmptySegment reports whether any segment of `path` is empty
+func hasEmptySegment(path []string) bool {
+	for _, segment := range path {
+		if len(segment) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,343 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/cbroglie/mustache"
+)
+
+// VarRef represents a reference to a template variable
+type VarRef struct {
+	Name  string // dot separated variable path i.e. "es.cluster.name"
+	Scope string // dot separated path of the enclosing mustache sections
+	Line  int    // template line of the reference or 0 if unknown
+	// the reference renders fine without the variable i.e. as a condition
+	// or piped to `default`
+	Optional bool
+	// the variable only rendered if `Guard` is set i.e. within `{{if .x}}` or
+	// `{{#x}}` or nil if always rendered
+	Guard *VarRef
+}
+
+// MissingVarsError is returned when rendering in strict mode and the template
+// references variables that are not set
+type MissingVarsError struct {
+	Refs []VarRef
+}
+
+// Error implements the error interface
+func (e *MissingVarsError) Error() string {
+	var missing []string
+	for _, ref := range e.Refs {
+		missing = append(missing, fmt.Sprintf("%s (line %d)", ref.Name, ref.Line))
+	}
+	return "missing variables: " + strings.Join(missing, ", ")
+}
+
+// checkMissingVars returns a MissingVarsError listing every required ref not
+// resolvable in `vars` or nil if all required refs resolve
+func checkMissingVars(refs []VarRef, vars interface{}) error {
+	var missing []VarRef
+	for _, ref := range refs {
+		if isRequiredRef(vars, ref) && !hasVarRef(vars, ref) {
+			missing = append(missing, ref)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &MissingVarsError{Refs: missing}
+}
+
+// isRequiredRef reports whether `ref` must resolve in `vars` for the template
+// to render, that is it is not optional and every guard around it is set
+func isRequiredRef(vars interface{}, ref VarRef) bool {
+	if ref.Optional {
+		return false
+	}
+	for guard := ref.Guard; guard != nil; guard = guard.Guard {
+		if !hasVarRef(vars, *guard) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasVarRef reports whether `ref` resolves in `vars` by searching the ref's
+// scope from the innermost section out to the root like mustache does
+func hasVarRef(vars interface{}, ref VarRef) bool {
+	var scope []string
+	if len(ref.Scope) != 0 {
+		scope = strings.Split(ref.Scope, ".")
+	}
+	for i := len(scope); i >= 0; i-- {
+		path := append(append([]string{}, scope[:i]...), strings.Split(ref.Name, ".")...)
+		if hasVarPath(vars, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVarPath reports whether `path` resolves to a value in `vars`
+func hasVarPath(vars interface{}, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	var val interface{}
+	var ok bool
+	switch v := vars.(type) {
+	case map[string]string:
+		val, ok = v[path[0]]
+	case map[string]interface{}:
+		val, ok = v[path[0]]
+	case namespace:
+		val, ok = v[path[0]]
+	}
+	return ok && hasVarPath(val, path[1:])
+}
+
+// goRefs returns every variable referenced relative to the root data of a
+// parsed go template including the bodies of templates invoked with the root
+// data i.e. {{template "x" .}} or {{block "x" .}}. References within `range`
+// and `with` bodies are excluded since the data they refer to changes at
+// render time. References in `if` and `with` conditions and pipelines ending
+// with `default` are optional and the body of an `if` on a single variable is
+// guarded by it.
+func goRefs(t *template.Template, tplData string) []VarRef {
+	var refs []VarRef
+	var walking = make(map[string]bool) // invoked templates being walked
+	var walk func(node parse.Node, root, optional bool, guard *VarRef)
+	// walkCond walks an `if` or `with` condition returning the variable guarding
+	// its body when the condition is just that variable i.e. {{if .x}}
+	walkCond := func(pipe *parse.PipeNode, root bool, guard *VarRef) *VarRef {
+		var start = len(refs)
+		walk(pipe, root, true, guard)
+		if len(refs)-start != 1 || len(pipe.Decl) != 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+			return guard
+		}
+		var cond = refs[start]
+		cond.Optional = false
+		return &cond
+	}
+	walk = func(node parse.Node, root, optional bool, guard *VarRef) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child, root, optional, guard)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, root, optional, guard)
+		case *parse.TemplateNode:
+			walk(n.Pipe, root, optional, guard)
+			invoked := t.Lookup(n.Name)
+			if !root || !isRootPipe(n.Pipe) || invoked == nil || invoked.Tree == nil || walking[n.Name] {
+				return
+			}
+			walking[n.Name] = true
+			walk(invoked.Tree.Root, true, optional, guard)
+			walking[n.Name] = false
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			// i.e. {{.x | default "y"}} or {{default "y" .x}}
+			if len(n.Cmds) != 0 {
+				last := n.Cmds[len(n.Cmds)-1]
+				if id, ok := last.Args[0].(*parse.IdentifierNode); ok && id.Ident == "default" {
+					optional = true
+				}
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd, root, optional, guard)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg, root, optional, guard)
+			}
+		case *parse.ChainNode:
+			walk(n.Node, root, optional, guard)
+		case *parse.IfNode:
+			walk(n.List, root, optional, walkCond(n.Pipe, root, guard))
+			walk(n.ElseList, root, optional, guard)
+		case *parse.RangeNode:
+			walk(n.Pipe, root, optional, guard)
+			walk(n.List, false, optional, guard)
+			walk(n.ElseList, root, optional, guard)
+		case *parse.WithNode:
+			walkCond(n.Pipe, root, guard)
+			walk(n.List, false, optional, guard)
+			walk(n.ElseList, root, optional, guard)
+		case *parse.FieldNode:
+			if root {
+				refs = append(refs, VarRef{Name: strings.Join(n.Ident, "."), Line: lineAt(tplData, int(n.Position())), Optional: optional, Guard: guard})
+			}
+		case *parse.VariableNode:
+			// `$` always refers to the root data
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				refs = append(refs, VarRef{Name: strings.Join(n.Ident[1:], "."), Line: lineAt(tplData, int(n.Position())), Optional: optional, Guard: guard})
+			}
+		}
+	}
+	if t.Tree != nil && t.Tree.Root != nil {
+		walk(t.Tree.Root, true, false, nil)
+	}
+	return refs
+}
+
+// isRootPipe reports whether `pipe` is just the root data i.e. "." or "$"
+func isRootPipe(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Decl) != 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return true
+	case *parse.VariableNode:
+		return len(arg.Ident) == 1 && arg.Ident[0] == "$"
+	}
+	return false
+}
+
+// fillMissingVars returns a copy of `vars` where every ref in `refs` that
+// doesn't resolve is set to an empty string so optional references (i.e.
+// conditions) render when missing keys are an execution error
+func fillMissingVars(vars interface{}, refs []VarRef) interface{} {
+	var missing [][]string
+	for _, ref := range refs {
+		if !hasVarRef(vars, ref) {
+			missing = append(missing, strings.Split(ref.Name, "."))
+		}
+	}
+	if len(missing) == 0 {
+		return vars
+	}
+	switch v := vars.(type) {
+	case map[string]string:
+		filled := make(map[string]string, len(v)+len(missing))
+		for name, val := range v {
+			filled[name] = val
+		}
+		for _, path := range missing {
+			if _, ok := filled[path[0]]; !ok && len(path) == 1 {
+				filled[path[0]] = ""
+			}
+		}
+		return filled
+	case map[string]interface{}:
+		filled := copyVars(v)
+		for _, path := range missing {
+			fillVarPath(filled, path)
+		}
+		return filled
+	}
+	return vars
+}
+
+// fillVarPath sets `path` in `vars` to an empty string creating (or copying)
+// the maps along the way unless any part of the path is already set to a
+// non map value
+func fillVarPath(vars map[string]interface{}, path []string) {
+	for i, key := range path {
+		val, ok := vars[key]
+		if i == len(path)-1 {
+			if !ok {
+				vars[key] = ""
+			}
+			return
+		}
+		var child map[string]interface{}
+		if !ok {
+			child = make(map[string]interface{})
+		} else if m, isMap := val.(map[string]interface{}); isMap {
+			child = copyVars(m)
+		} else {
+			return
+		}
+		vars[key] = child
+		vars = child
+	}
+}
+
+// copyVars returns a shallow copy of `vars`
+func copyVars(vars map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(vars))
+	for name, val := range vars {
+		copied[name] = val
+	}
+	return copied
+}
+
+// mustacheRefs returns every variable and section referenced in a mustache
+// template where the scope of each reference is the path of its enclosing
+// sections. Section names are optional since an unset section is simply not
+// rendered, references within a section are guarded by it and references
+// within an inverted section are optional.
+func mustacheRefs(tplData string) ([]VarRef, error) {
+	t, err := mustache.ParseString(tplData)
+	if err != nil {
+		return nil, err
+	}
+	var refs []VarRef
+	var seen = make(map[string]int)
+	var walk func(tags []mustache.Tag, scope string, optional bool, guard *VarRef)
+	walk = func(tags []mustache.Tag, scope string, optional bool, guard *VarRef) {
+		for _, tag := range tags {
+			switch tag.Type() {
+			case mustache.Variable, mustache.Section, mustache.InvertedSection:
+				if tag.Name() == "." { // implicit iterator
+					continue
+				}
+				refs = append(refs, VarRef{
+					Name:     tag.Name(),
+					Scope:    scope,
+					Line:     mustacheTagLine(tplData, tag.Name(), seen[tag.Name()]),
+					Optional: optional || tag.Type() != mustache.Variable,
+					Guard:    guard,
+				})
+				seen[tag.Name()]++
+			}
+			if tag.Type() == mustache.Section || tag.Type() == mustache.InvertedSection {
+				var inner = tag.Name()
+				if len(scope) != 0 {
+					inner = scope + "." + inner
+				}
+				if tag.Type() == mustache.InvertedSection {
+					walk(tag.Tags(), inner, true, guard)
+					continue
+				}
+				var section = refs[len(refs)-1]
+				section.Optional = false
+				walk(tag.Tags(), inner, optional, &section)
+			}
+		}
+	}
+	walk(t.Tags(), "", false, nil)
+	return refs, nil
+}
+
+// mustacheTagLine returns the line of the nth opening tag named `name` or 0
+// if it can't be found (i.e. custom delimiters)
+func mustacheTagLine(tplData, name string, n int) int {
+	re := regexp.MustCompile(`\{\{\{?[#^&]?\s*` + regexp.QuoteMeta(name) + `\s*\}?\}\}`)
+	matches := re.FindAllStringIndex(tplData, -1)
+	if n >= len(matches) {
+		return 0
+	}
+	return lineAt(tplData, matches[n][0])
+}
+
+// lineAt returns the line number of byte offset `pos` in `text`
+func lineAt(text string, pos int) int {
+	if pos > len(text) {
+		pos = len(text)
+	}
+	return 1 + strings.Count(text[:pos], "\n")
+}
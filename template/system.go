@@ -0,0 +1,168 @@
+package template
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CgroupRoot is the cgroup filesystem mount the `cpuCount` and `memLimit`
+// template functions read container limits from
+var CgroupRoot = "/sys/fs/cgroup"
+
+// MeminfoPath is the path `memLimit` reads total memory from when the
+// container memory is not limited
+var MeminfoPath = "/proc/meminfo"
+
+// interfaceIP returns the first IPv4 address of the network interface `name`
+// or its first IPv6 address if it has no IPv4 address
+func interfaceIP(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var ipv6 string
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip := ipnet.IP.To4(); ip != nil {
+			return ip.String(), nil
+		}
+		if len(ipv6) == 0 {
+			ipv6 = ipnet.IP.String()
+		}
+	}
+	if len(ipv6) == 0 {
+		return "", errors.New("interface " + name + " has no ip address")
+	}
+	return ipv6, nil
+}
+
+// lookupHost returns the sorted addresses of `host`
+func lookupHost(host string) ([]string, error) {
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// lookupSRV returns the "target:port" addresses of the SRV records of
+// `name` in priority order. With a service and proto, _service._proto.name is
+// looked up, otherwise `name` is looked up directly.
+func lookupSRV(service, proto, name string) ([]string, error) {
+	_, srvs, err := net.LookupSRV(service, proto, name)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(srvs))
+	for i, srv := range srvs {
+		addrs[i] = net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+	}
+	return addrs, nil
+}
+
+// cpuCount returns the number of cpus available to the container rounded up
+// from the cgroup cpu quota or the number of host cpus if not limited
+func cpuCount() int {
+	var quota, period int64
+	var err error
+	if isCgroupV2() {
+		// cpu.max is "<quota|max> <period>"
+		fields := strings.Fields(readCgroupFile("cpu.max"))
+		if len(fields) == 2 && fields[0] != "max" {
+			quota, err = strconv.ParseInt(fields[0], 10, 64)
+			if err == nil {
+				period, err = strconv.ParseInt(fields[1], 10, 64)
+			}
+		}
+	} else {
+		quota, err = strconv.ParseInt(readCgroupFile("cpu", "cpu.cfs_quota_us"), 10, 64)
+		if err == nil {
+			period, err = strconv.ParseInt(readCgroupFile("cpu", "cpu.cfs_period_us"), 10, 64)
+		}
+	}
+	var cpus = runtime.NumCPU()
+	if err != nil || quota <= 0 || period <= 0 {
+		return cpus
+	}
+	if limit := int((quota + period - 1) / period); limit < cpus {
+		return limit
+	}
+	return cpus
+}
+
+// memLimit returns the memory in bytes available to the container from the
+// cgroup memory limit or the total host memory if not limited
+func memLimit() (int64, error) {
+	var limit string
+	if isCgroupV2() {
+		limit = readCgroupFile("memory.max")
+	} else {
+		limit = readCgroupFile("memory", "memory.limit_in_bytes")
+	}
+	total, err := memTotal()
+	if err != nil {
+		return 0, err
+	}
+	// cgroup v1 reports no limit as a very large number
+	if bytes, err := strconv.ParseInt(limit, 10, 64); err == nil && bytes > 0 && bytes < total {
+		return bytes, nil
+	}
+	return total, nil
+}
+
+// memTotal returns the total host memory in bytes
+func memTotal() (int64, error) {
+	f, err := os.Open(MeminfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:       16303348 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemTotal:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("MemTotal not found in " + MeminfoPath)
+}
+
+// isCgroupV2 reports whether the cgroup root is a unified (v2) hierarchy
+func isCgroupV2() bool {
+	_, err := os.Stat(filepath.Join(CgroupRoot, "cgroup.controllers"))
+	return err == nil
+}
+
+// readCgroupFile returns the trimmed contents of a file relative to the cgroup
+// root or empty string if it can't be read
+func readCgroupFile(path ...string) string {
+	data, err := ioutil.ReadFile(filepath.Join(append([]string{CgroupRoot}, path...)...))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
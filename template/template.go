@@ -6,17 +6,43 @@ import (
 	"os"
 )
 
+// Options template rendering options
+type Options struct {
+	Strict    bool              // fail rendering when referenced vars are missing
+	Coerce    bool              // coerce var values to typed values by convention
+	Types     map[string]string // declared var types by var name
+	NestDelim string            // var name delimiter for nested vars i.e. "__"
+	FileRoots []string          // dirs file template functions may access
+}
+
 // Template model
 type Template struct {
 	path   string
 	vars   map[string]string
+	data   interface{}
 	file   *os.File
 	engine Engine
+	opts   Options
 }
 
 // New creates a new template
 func New(path string, vars map[string]string, engine Engine) *Template {
-	return &Template{path: path, vars: vars, engine: engine}
+	return NewWithOptions(path, vars, engine, Options{})
+}
+
+// NewWithOptions creates a new template with rendering options
+func NewWithOptions(path string, vars map[string]string, engine Engine, opts Options) *Template {
+	return &Template{path: path, vars: vars, engine: engine, opts: opts}
+}
+
+// Path getter for template path
+func (t *Template) Path() string {
+	return t.path
+}
+
+// Options getter for template rendering options
+func (t *Template) Options() Options {
+	return t.opts
 }
 
 // Vars getter for template vars
@@ -24,6 +50,28 @@ func (t *Template) Vars() map[string]string {
 	return t.vars
 }
 
+// Data returns the data the template is rendered with. Without any coercion
+// or nesting options this is the same as `Vars`, otherwise the vars are
+// coerced to typed values and nested by delimited var names.
+func (t *Template) Data() (interface{}, error) {
+	if t.data != nil {
+		return t.data, nil
+	}
+	if !t.opts.Coerce && len(t.opts.Types) == 0 && len(t.opts.NestDelim) == 0 {
+		t.data = t.vars
+		return t.data, nil
+	}
+	data, err := coerceVars(t.vars, t.opts.Types, t.opts.Coerce)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.opts.NestDelim) != 0 {
+		nestVars(data, t.opts.NestDelim)
+	}
+	t.data = data
+	return t.data, nil
+}
+
 // ReadAllToBytes reads all data from template file to byte array
 func (t *Template) ReadAllToBytes() ([]byte, error) {
 	if t.file == nil {
@@ -50,3 +98,27 @@ func (t *Template) ReadAllToString() (string, error) {
 func (t *Template) Render(w io.Writer) error {
 	return t.engine.Render(t, w)
 }
+
+// Refs returns the variables referenced by this template
+func (t *Template) Refs() ([]VarRef, error) {
+	return t.engine.Refs(t)
+}
+
+// HasVar reports whether the referenced variable is set in the template data
+func (t *Template) HasVar(ref VarRef) bool {
+	data, err := t.Data()
+	if err != nil {
+		return hasVarRef(t.vars, ref)
+	}
+	return hasVarRef(data, ref)
+}
+
+// RequiresVar reports whether the referenced variable must be set for the
+// template to render in strict mode given the template data
+func (t *Template) RequiresVar(ref VarRef) bool {
+	data, err := t.Data()
+	if err != nil {
+		return isRequiredRef(t.vars, ref)
+	}
+	return isRequiredRef(data, ref)
+}
@@ -0,0 +1,10 @@
+#!/bin/sh
+# validates every rendered config exists and contains $1
+for i in 1 2; do
+  eval "cfg=\$RDCT_RENDERED_CFG_PATH_$i"
+  if ! grep -q "$1" "$cfg"; then
+    echo "invalid config $cfg" >&2
+    exit 1
+  fi
+done
+echo "config ok: $RDCT_RENDERED_CFG_PATHS"
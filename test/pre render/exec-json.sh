@@ -0,0 +1,2 @@
+#!/bin/sh
+printf '%s\n' '{"pre_render": "json", "pre_render_pem": "a\nb", "pre_render_port": 8080}' > "$RDCT_OUTPUT"
@@ -0,0 +1,4 @@
+#!/bin/sh
+echo 'exec pre-render script'
+echo "pre_render=exec" >> "$RDCT_OUTPUT"
+echo "pre_render_opts='-Dfoo=bar'" >> "$RDCT_OUTPUT"
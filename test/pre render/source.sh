@@ -0,0 +1,2 @@
+#!/usr/bin/env sh
+export pre_render="spaces"
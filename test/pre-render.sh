@@ -4,3 +4,8 @@ export test_app_var="override"
 echo 'mid pre-render script'
 export pre_render="test"
 echo 'end pre-render script'
+export pre_render_opts="-Dfoo=bar -Dbaz=qux=="
+export pre_render_empty=""
+export pre_render_pem="-----BEGIN CERTIFICATE-----
+MIIB
+-----END CERTIFICATE-----"
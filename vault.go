@@ -0,0 +1,191 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// env vars for vault source config where VAULT_ADDR and VAULT_TOKEN are the
+// same as the vault cli
+const (
+	envKeyVaultAddr         = "VAULT_ADDR"
+	envKeyVaultToken        = "VAULT_TOKEN"
+	envKeyVaultKVVersion    = "VAULT_KV_VERSION"
+	envKeyVaultAuthMount    = "VAULT_AUTH_MOUNT"
+	envKeyVaultRoleID       = "VAULT_ROLE_ID"
+	envKeyVaultSecretID     = "VAULT_SECRET_ID"
+	envKeyVaultK8sRole      = "VAULT_K8S_ROLE"
+	envKeyVaultK8sTokenPath = "VAULT_K8S_TOKEN_PATH"
+)
+
+// DefaultVaultK8sTokenPath is the default kubernetes service account token
+// path used for vault kubernetes auth
+const DefaultVaultK8sTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultSource loads variables from a vault KV v1 or v2 secret. The first
+// segment of `Path` is the secrets engine mount i.e. "secret/myapp". Auth uses
+// `Token` if set, otherwise AppRole if `RoleID` is set, otherwise kubernetes
+// if `K8sRole` is set.
+type VaultSource struct {
+	Addr         string
+	Path         string
+	KVVersion    int    // 1 or 2 (default)
+	Token        string // token auth
+	AuthMount    string // approle or kubernetes auth mount (default approle or kubernetes)
+	RoleID       string // approle auth
+	SecretID     string // approle auth
+	K8sRole      string // kubernetes auth
+	K8sTokenPath string // kubernetes auth (default DefaultVaultK8sTokenPath)
+	Client       *http.Client
+}
+
+// NewVaultSource returns a vault source for `path` configured from the
+// VAULT_ADDR, VAULT_TOKEN and RDCT_VAULT_* env vars
+func NewVaultSource(path string, env *Env) (*VaultSource, error) {
+	s := &VaultSource{
+		Addr:         env.Find(envKeyVaultAddr),
+		Path:         path,
+		KVVersion:    2,
+		Token:        env.Find(envKeyVaultToken),
+		AuthMount:    env.Find(envKeyPrefix + envKeyVaultAuthMount),
+		RoleID:       env.Find(envKeyPrefix + envKeyVaultRoleID),
+		SecretID:     env.Find(envKeyPrefix + envKeyVaultSecretID),
+		K8sRole:      env.Find(envKeyPrefix + envKeyVaultK8sRole),
+		K8sTokenPath: env.Find(envKeyPrefix + envKeyVaultK8sTokenPath),
+	}
+	if v := env.Find(envKeyPrefix + envKeyVaultKVVersion); len(v) != 0 {
+		var err error
+		if s.KVVersion, err = strconv.Atoi(v); err != nil || (s.KVVersion != 1 && s.KVVersion != 2) {
+			return nil, errors.New("invalid " + envKeyPrefix + envKeyVaultKVVersion + " (expected 1 or 2): " + v)
+		}
+	}
+	return s, nil
+}
+
+// Load implements the Source interface
+func (s *VaultSource) Load() (map[string]string, error) {
+	if len(s.Addr) == 0 {
+		return nil, errors.New("vault: empty " + envKeyVaultAddr)
+	}
+	token, err := s.login()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("vault: login: ", err))
+	}
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = s.do("GET", s.secretPath(), token, nil, &resp); err != nil {
+		return nil, errors.New(fmt.Sprint("vault: ", s.Path, ": ", err))
+	}
+	var data = resp.Data
+	if s.KVVersion != 1 {
+		data, _ = resp.Data["data"].(map[string]interface{})
+	}
+	return stringifyVars(data)
+}
+
+// secretPath returns the api path of the secret for the KV version
+func (s *VaultSource) secretPath() string {
+	path := strings.Trim(s.Path, "/")
+	if s.KVVersion == 1 {
+		return "/v1/" + path
+	}
+	pair := strings.SplitN(path, "/", 2)
+	if len(pair) == 1 {
+		return "/v1/" + pair[0] + "/data"
+	}
+	return "/v1/" + pair[0] + "/data/" + pair[1]
+}
+
+// login returns a vault token for the configured auth method
+func (s *VaultSource) login() (string, error) {
+	var mount string
+	var body map[string]string
+	switch {
+	case len(s.Token) != 0:
+		return s.Token, nil
+	case len(s.RoleID) != 0:
+		mount = "approle"
+		body = map[string]string{"role_id": s.RoleID, "secret_id": s.SecretID}
+	case len(s.K8sRole) != 0:
+		var tokenPath = s.K8sTokenPath
+		if len(tokenPath) == 0 {
+			tokenPath = DefaultVaultK8sTokenPath
+		}
+		jwt, err := ioutil.ReadFile(tokenPath)
+		if err != nil {
+			return "", err
+		}
+		mount = "kubernetes"
+		body = map[string]string{"role": s.K8sRole, "jwt": strings.TrimSpace(string(jwt))}
+	default:
+		return "", errors.New("no auth configured (expected " + envKeyVaultToken + ", " +
+			envKeyPrefix + envKeyVaultRoleID + " or " + envKeyPrefix + envKeyVaultK8sRole + ")")
+	}
+	if len(s.AuthMount) != 0 {
+		mount = strings.Trim(s.AuthMount, "/")
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := s.do("POST", "/v1/auth/"+mount+"/login", "", body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Auth.ClientToken) == 0 {
+		return "", errors.New("empty client token")
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+// do sends a vault api request and decodes the JSON response into `out`
+func (s *VaultSource) do(method, path, token string, body interface{}, out interface{}) error {
+	var reqBody = new(bytes.Buffer)
+	if body != nil {
+		if err := json.NewEncoder(reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(s.Addr, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if len(token) != 0 {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	var client = s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(data, &errResp)
+		if len(errResp.Errors) != 0 {
+			return errors.New(fmt.Sprint(resp.Status, ": ", strings.Join(errResp.Errors, ", ")))
+		}
+		return errors.New(resp.Status)
+	}
+	// keep numbers as json.Number so they load exactly as written
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
@@ -0,0 +1,110 @@
+package redact
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// vaultStandIn returns a local http stand-in for the vault api serving a KV v1
+// secret at kv/myapp and a KV v2 secret at secret/myapp
+func vaultStandIn() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			switch {
+			case r.URL.Path == "/v1/auth/approle/login" && body["role_id"] == "role" && body["secret_id"] == "secret",
+				r.URL.Path == "/v1/auth/k8s/login" && body["role"] == "app" && body["jwt"] == "jwt":
+				w.Write([]byte(`{"auth": {"client_token": "login-token"}}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors": ["invalid credentials"]}`))
+			}
+			return
+		}
+		if token := r.Header.Get("X-Vault-Token"); token != "token" && token != "login-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/myapp":
+			w.Write([]byte(`{"data": {"db_password": "v1", "db_port": 5432}}`))
+		case "/v1/secret/data/myapp":
+			w.Write([]byte(`{"data": {"data": {"db_password": "v2", "db_port": 5432}, "metadata": {"version": 1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+}
+
+func TestVaultSource(t *testing.T) {
+	server := vaultStandIn()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "redact-vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jwtPath := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(jwtPath, []byte("jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		password string
+		source   *VaultSource
+	}{
+		{"v1", &VaultSource{Addr: server.URL, Path: "kv/myapp", KVVersion: 1, Token: "token"}},
+		{"v2", &VaultSource{Addr: server.URL, Path: "secret/myapp", KVVersion: 2, Token: "token"}},
+		{"v2", &VaultSource{Addr: server.URL, Path: "secret/myapp", KVVersion: 2, RoleID: "role", SecretID: "secret"}},
+		{"v2", &VaultSource{Addr: server.URL, Path: "/secret/myapp", KVVersion: 2, K8sRole: "app", K8sTokenPath: jwtPath, AuthMount: "k8s"}},
+	}
+	for _, c := range cases {
+		vars, err := c.source.Load()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if vars["db_password"] != c.password || vars["db_port"] != "5432" {
+			t.Error("Expected db_password=", c.password, " and db_port=5432, got: ", vars)
+		}
+	}
+	failing := []*VaultSource{
+		{Addr: server.URL, Path: "secret/myapp", KVVersion: 2, Token: "invalid"},
+		{Addr: server.URL, Path: "secret/missing", KVVersion: 2, Token: "token"},
+		{Addr: server.URL, Path: "secret/myapp", KVVersion: 2, RoleID: "role", SecretID: "invalid"},
+		{Addr: server.URL, Path: "secret/myapp", KVVersion: 2, K8sRole: "app", K8sTokenPath: filepath.Join(dir, "missing")},
+		{Addr: server.URL, Path: "secret/myapp", KVVersion: 2},
+		{Path: "secret/myapp", KVVersion: 2, Token: "token"},
+	}
+	for _, source := range failing {
+		if _, err = source.Load(); err == nil {
+			t.Error("Expected err to be error, got: nil")
+		}
+	}
+}
+
+func TestNewVaultSource(t *testing.T) {
+	env := &Env{map[string]string{
+		"VAULT_ADDR":            "http://vault:8200",
+		"RDCT_VAULT_KV_VERSION": "1",
+		"RDCT_VAULT_ROLE_ID":    "role",
+	}}
+	source, err := NewVaultSource("kv/myapp", env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.Addr != "http://vault:8200" || source.KVVersion != 1 || source.RoleID != "role" {
+		t.Error("Unexpected vault source: ", source)
+	}
+	env.env["RDCT_VAULT_KV_VERSION"] = "3"
+	if _, err = NewVaultSource("kv/myapp", env); err == nil {
+		t.Error("Expected err to be error, got: nil")
+	}
+}
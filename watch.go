@@ -0,0 +1,155 @@
+package redact
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// name of the data dir symlink of kubernetes ConfigMap and Secret volumes
+const k8sVolumeDataDir = "..data"
+
+// Watcher reports changes to files and directories. Parent directories are
+// watched rather than the files themselves so atomic renames over a file and
+// kubernetes volume symlink swaps are seen. Changes within `Debounce` of each
+// other are reported once.
+type Watcher struct {
+	Debounce time.Duration
+	Changes  chan []string // changed watched paths
+	Errors   chan error
+	watcher  *fsnotify.Watcher
+	files    map[string]bool // watched file paths
+	dirs     map[string]bool // watched dir paths where any change is reported
+	done     chan struct{}
+}
+
+// NewWatcher creates a watcher for the file or directory `paths`
+func NewWatcher(paths []string, debounce time.Duration) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		Debounce: debounce,
+		Changes:  make(chan []string),
+		Errors:   make(chan error),
+		watcher:  fsw,
+		files:    make(map[string]bool),
+		dirs:     make(map[string]bool),
+		done:     make(chan struct{}),
+	}
+	var watched = make(map[string]bool)
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			fsw.Close()
+			return nil, err
+		}
+		var dir = filepath.Dir(abs)
+		if info, err := os.Stat(abs); err == nil && info.IsDir() {
+			w.dirs[abs] = true
+			dir = abs
+		} else {
+			w.files[abs] = true
+		}
+		if watched[dir] {
+			continue
+		}
+		if err = fsw.Add(dir); err != nil {
+			fsw.Close()
+			return nil, err
+		}
+		watched[dir] = true
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
+
+// run reports debounced changes until closed
+func (w *Watcher) run() {
+	var changed = make(map[string]bool)
+	var timer = time.NewTimer(w.Debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-w.done:
+			timer.Stop()
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			for _, path := range w.match(event.Name) {
+				changed[path] = true
+				timer.Reset(w.Debounce)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			select {
+			case w.Errors <- err:
+			case <-w.done:
+				return
+			}
+		case <-timer.C:
+			var paths []string
+			for path := range changed {
+				paths = append(paths, path)
+			}
+			changed = make(map[string]bool)
+			select {
+			case w.Changes <- paths:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// match returns the watched paths an event for `name` is a change to
+func (w *Watcher) match(name string) []string {
+	var dir = filepath.Dir(name)
+	if w.dirs[dir] {
+		return []string{dir}
+	}
+	if w.files[name] {
+		return []string{name}
+	}
+	// kubernetes volume files are symlinks into a "..data" dir symlink which is
+	// swapped on update so every watched file in the dir may have changed
+	var paths []string
+	if filepath.Base(name) == k8sVolumeDataDir {
+		for path := range w.files {
+			if filepath.Dir(path) == dir {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// WatchPaths returns the paths of the file and directory based variable
+// sources in `sources`
+func WatchPaths(sources []Source) []string {
+	var paths []string
+	for _, source := range sources {
+		switch s := source.(type) {
+		case *DotEnvSource:
+			paths = append(paths, s.Path)
+		case *FileSource:
+			paths = append(paths, s.Path)
+		case *DirSource:
+			paths = append(paths, s.Path)
+		}
+	}
+	return paths
+}
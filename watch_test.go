@@ -0,0 +1,60 @@
+package redact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tplPath := filepath.Join(dir, "app.conf.redacted")
+	if err = ioutil.WriteFile(tplPath, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srcDir := filepath.Join(dir, "secrets")
+	if err = os.Mkdir(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher([]string{tplPath, srcDir}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// unwatched files in the same dir are ignored
+	ioutil.WriteFile(filepath.Join(dir, "other"), []byte("a"), 0644)
+	// several changes are reported once
+	ioutil.WriteFile(tplPath, []byte("b"), 0644)
+	ioutil.WriteFile(filepath.Join(srcDir, "password"), []byte("c"), 0644)
+	select {
+	case changed := <-w.Changes:
+		if len(changed) != 2 {
+			t.Error("Expected 2 changed paths, got: ", changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected changes, got none")
+	}
+	select {
+	case changed := <-w.Changes:
+		t.Error("Expected no more changes, got: ", changed)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatchPaths(t *testing.T) {
+	paths := WatchPaths([]Source{
+		new(EnvSource),
+		&DotEnvSource{Path: "a.env"},
+		&FileSource{Path: "b.yaml"},
+		&DirSource{Path: "c"},
+	})
+	if len(paths) != 3 || paths[0] != "a.env" || paths[1] != "b.yaml" || paths[2] != "c" {
+		t.Error("Expected [a.env b.yaml c], got: ", paths)
+	}
+}